@@ -0,0 +1,286 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/mailer"
+	"backend/utils"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is every runtime setting of the server. .env.example documents
+// the variables each field is read from.
+type Config struct {
+	ListenAddr string
+	Server     ServerConfig
+	DB         DBConfig
+
+	JWT                  utils.TokenConfig
+	AccessTokenTTL       time.Duration
+	RefreshTokenTTL      time.Duration
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+
+	// CORSOrigins lists the origins allowed to call the API; "*" allows any.
+	CORSOrigins []string
+	LogLevel    slog.Level
+
+	// AppURL is the base of links into the web app sent by email.
+	AppURL          string
+	Mail            mailer.Config
+	RequireAdmin2FA bool
+	TOTPIssuer      string
+	MigrateOnStart  bool
+
+	CourseRetention     time.Duration
+	CoursePurgeInterval time.Duration
+}
+
+type ServerConfig struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests may take to finish
+	// after SIGTERM before the server stops anyway.
+	ShutdownTimeout time.Duration
+}
+
+type DBConfig struct {
+	URL             string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// QueryTimeout becomes the statement_timeout of every connection; zero
+	// turns it off.
+	QueryTimeout time.Duration
+	// ConnectRetries is how many times connecting is attempted at startup,
+	// waiting ConnectRetryDelay after the first failure and doubling it
+	// after each further one.
+	ConnectRetries    int
+	ConnectRetryDelay time.Duration
+}
+
+// App is the configuration the server was started with. It holds the
+// defaults until main replaces it with the result of Load.
+var App = defaults()
+
+func defaults() *Config {
+	return &Config{
+		ListenAddr: ":8000",
+		Server: ServerConfig{
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		DB: DBConfig{
+			MaxConns:          10,
+			MinConns:          1,
+			MaxConnLifetime:   time.Hour,
+			MaxConnIdleTime:   30 * time.Minute,
+			QueryTimeout:      10 * time.Second,
+			ConnectRetries:    5,
+			ConnectRetryDelay: 2 * time.Second,
+		},
+		AccessTokenTTL:       15 * time.Minute,
+		RefreshTokenTTL:      30 * 24 * time.Hour,
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: 48 * time.Hour,
+		CORSOrigins:          []string{"*"},
+		LogLevel:             slog.LevelInfo,
+		AppURL:               "http://localhost:5173",
+		TOTPIssuer:           "FlexNative",
+		CourseRetention:      30 * 24 * time.Hour,
+		CoursePurgeInterval:  time.Hour,
+	}
+}
+
+// Load reads the configuration from the environment. Variables missing
+// there are taken from .env in the working directory and then from the
+// dotenv-style file named by CONFIG_FILE, if set. Every invalid setting is
+// reported, not just the first.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := godotenv.Load(path); err != nil {
+			return nil, fmt.Errorf("reading CONFIG_FILE: %w", err)
+		}
+	}
+
+	c := defaults()
+	var e env
+
+	c.ListenAddr = e.string("LISTEN_ADDR", c.ListenAddr)
+	c.Server.ReadTimeout = e.duration("SERVER_READ_TIMEOUT", c.Server.ReadTimeout, false)
+	c.Server.WriteTimeout = e.duration("SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout, false)
+	c.Server.IdleTimeout = e.duration("SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout, false)
+	c.Server.ShutdownTimeout = e.duration("SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout, false)
+
+	c.DB.URL = e.string("DATABASE_URL", "")
+	if c.DB.URL == "" {
+		e.fail("DATABASE_URL is not set")
+	}
+	c.DB.MaxConns = int32(e.int("DB_MAX_CONNS", int(c.DB.MaxConns), 1))
+	c.DB.MinConns = int32(e.int("DB_MIN_CONNS", int(c.DB.MinConns), 0))
+	if c.DB.MinConns > c.DB.MaxConns {
+		e.fail("DB_MIN_CONNS (%d) must not exceed DB_MAX_CONNS (%d)", c.DB.MinConns, c.DB.MaxConns)
+	}
+	c.DB.MaxConnLifetime = e.duration("DB_MAX_CONN_LIFETIME", c.DB.MaxConnLifetime, false)
+	c.DB.MaxConnIdleTime = e.duration("DB_MAX_CONN_IDLE_TIME", c.DB.MaxConnIdleTime, false)
+	c.DB.QueryTimeout = e.duration("DB_QUERY_TIMEOUT", c.DB.QueryTimeout, true)
+	c.DB.ConnectRetries = e.int("DB_CONNECT_RETRIES", c.DB.ConnectRetries, 1)
+	c.DB.ConnectRetryDelay = e.duration("DB_CONNECT_RETRY_DELAY", c.DB.ConnectRetryDelay, false)
+
+	c.JWT = utils.TokenConfig{
+		Secret:    e.string("JWT_SECRET", ""),
+		KeysDir:   e.string("JWT_KEYS_DIR", ""),
+		ActiveKID: e.string("JWT_ACTIVE_KID", ""),
+	}
+	if err := c.JWT.Validate(); err != nil {
+		e.fail("%v", err)
+	}
+	c.AccessTokenTTL = e.duration("ACCESS_TOKEN_TTL", c.AccessTokenTTL, false)
+	c.RefreshTokenTTL = e.duration("REFRESH_TOKEN_TTL", c.RefreshTokenTTL, false)
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		e.fail("REFRESH_TOKEN_TTL (%s) must not be shorter than ACCESS_TOKEN_TTL (%s)", c.RefreshTokenTTL, c.AccessTokenTTL)
+	}
+	c.PasswordResetTTL = e.duration("PASSWORD_RESET_TTL", c.PasswordResetTTL, false)
+	c.EmailVerificationTTL = e.duration("EMAIL_VERIFICATION_TTL", c.EmailVerificationTTL, false)
+
+	c.CORSOrigins = e.origins("CORS_ORIGINS", c.CORSOrigins)
+	c.LogLevel = e.logLevel("LOG_LEVEL", c.LogLevel)
+
+	c.AppURL = strings.TrimRight(e.string("APP_URL", c.AppURL), "/")
+	if u, err := url.Parse(c.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.fail("APP_URL must be an absolute http(s) URL, got %q", c.AppURL)
+	}
+	c.Mail = mailer.Config{
+		Driver:       strings.ToLower(e.string("MAIL_DRIVER", "log")),
+		Dir:          e.string("MAIL_DIR", "mail"),
+		From:         e.string("MAIL_FROM", ""),
+		SMTPHost:     e.string("SMTP_HOST", ""),
+		SMTPPort:     e.string("SMTP_PORT", "587"),
+		SMTPUsername: e.string("SMTP_USERNAME", ""),
+		SMTPPassword: e.string("SMTP_PASSWORD", ""),
+	}
+	if err := c.Mail.Validate(); err != nil {
+		e.fail("%v", err)
+	}
+	c.RequireAdmin2FA = e.bool("REQUIRE_ADMIN_2FA", c.RequireAdmin2FA)
+	c.TOTPIssuer = e.string("TOTP_ISSUER", c.TOTPIssuer)
+	c.MigrateOnStart = e.bool("MIGRATE_ON_START", c.MigrateOnStart)
+
+	c.CourseRetention = time.Duration(e.int("COURSE_RETENTION_DAYS", int(c.CourseRetention/(24*time.Hour)), 1)) * 24 * time.Hour
+	c.CoursePurgeInterval = e.duration("COURSE_PURGE_INTERVAL", c.CoursePurgeInterval, false)
+
+	if len(e.errs) > 0 {
+		return nil, errors.Join(e.errs...)
+	}
+	return c, nil
+}
+
+// env reads typed variables and collects a message for each invalid one.
+type env struct {
+	errs []error
+}
+
+func (e *env) fail(format string, args ...interface{}) {
+	e.errs = append(e.errs, fmt.Errorf(format, args...))
+}
+
+func (e *env) string(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	return def
+}
+
+func (e *env) int(key string, def, min int) int {
+	v := e.string(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min {
+		e.fail("%s must be an integer of at least %d, got %q", key, min, v)
+		return def
+	}
+	return n
+}
+
+func (e *env) bool(key string, def bool) bool {
+	v := e.string(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail("%s must be true or false, got %q", key, v)
+		return def
+	}
+	return b
+}
+
+func (e *env) duration(key string, def time.Duration, zeroOK bool) time.Duration {
+	v := e.string(key, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || (d == 0 && !zeroOK) {
+		e.fail("%s must be a positive duration such as 30s or 1h, got %q", key, v)
+		return def
+	}
+	return d
+}
+
+func (e *env) origins(key string, def []string) []string {
+	v := e.string(key, "")
+	if v == "" {
+		return def
+	}
+	var origins []string
+	for _, o := range strings.Split(v, ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "" {
+			continue
+		}
+		if o != "*" {
+			u, err := url.Parse(o)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+				e.fail("%s entries must be \"*\" or an origin such as https://app.example.com, got %q", key, o)
+				continue
+			}
+		}
+		origins = append(origins, o)
+	}
+	if len(origins) == 0 {
+		return def
+	}
+	return origins
+}
+
+func (e *env) logLevel(key string, def slog.Level) slog.Level {
+	v := e.string(key, "")
+	if v == "" {
+		return def
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		e.fail("%s must be debug, info, warn or error, got %q", key, v)
+		return def
+	}
+	return level
+}
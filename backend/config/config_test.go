@@ -0,0 +1,171 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configKeys are the variables Load reads. Blank values count as unset, so
+// clearing them keeps the test runner's environment out of the tests.
+var configKeys = []string{
+	"CONFIG_FILE", "LISTEN_ADDR", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT",
+	"SHUTDOWN_TIMEOUT", "DATABASE_URL", "DB_MAX_CONNS", "DB_MIN_CONNS", "DB_MAX_CONN_LIFETIME",
+	"DB_MAX_CONN_IDLE_TIME", "DB_QUERY_TIMEOUT", "DB_CONNECT_RETRIES", "DB_CONNECT_RETRY_DELAY",
+	"JWT_SECRET", "JWT_KEYS_DIR", "JWT_ACTIVE_KID", "ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL",
+	"PASSWORD_RESET_TTL", "EMAIL_VERIFICATION_TTL", "CORS_ORIGINS", "LOG_LEVEL", "APP_URL",
+	"MAIL_DRIVER", "MAIL_DIR", "MAIL_FROM", "SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD",
+	"REQUIRE_ADMIN_2FA", "TOTP_ISSUER", "MIGRATE_ON_START", "COURSE_RETENTION_DAYS", "COURSE_PURGE_INTERVAL",
+}
+
+// setEnv starts from the smallest valid environment and applies env on top.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Chdir(t.TempDir()) // no .env
+	for _, key := range configKeys {
+		t.Setenv(key, "")
+	}
+	t.Setenv("DATABASE_URL", "postgres://localhost/flexnative")
+	t.Setenv("JWT_SECRET", "secret")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setEnv(t, nil)
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := defaults()
+	want.DB.URL = "postgres://localhost/flexnative"
+	want.JWT.Secret = "secret"
+	want.Mail.Driver, want.Mail.Dir, want.Mail.SMTPPort = "log", "mail", "587"
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Load() = %+v\nwant %+v", c, want)
+	}
+}
+
+func TestLoadParsesSettings(t *testing.T) {
+	keys := t.TempDir()
+	setEnv(t, map[string]string{
+		"JWT_SECRET":            "",
+		"JWT_KEYS_DIR":          keys,
+		"JWT_ACTIVE_KID":        "2026-10",
+		"DB_QUERY_TIMEOUT":      "0",
+		"ACCESS_TOKEN_TTL":      "5m",
+		"CORS_ORIGINS":          " https://app.example.com/ , ,http://localhost:5173",
+		"LOG_LEVEL":             "WARN",
+		"APP_URL":               "https://app.example.com/",
+		"REQUIRE_ADMIN_2FA":     "true",
+		"COURSE_RETENTION_DAYS": "7",
+	})
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.JWT.KeysDir != keys || c.JWT.ActiveKID != "2026-10" || c.JWT.Secret != "" {
+		t.Errorf("JWT = %+v", c.JWT)
+	}
+	if c.DB.QueryTimeout != 0 || c.AccessTokenTTL != 5*time.Minute {
+		t.Errorf("QueryTimeout = %s, AccessTokenTTL = %s", c.DB.QueryTimeout, c.AccessTokenTTL)
+	}
+	if want := []string{"https://app.example.com", "http://localhost:5173"}; !reflect.DeepEqual(c.CORSOrigins, want) {
+		t.Errorf("CORSOrigins = %q, want %q", c.CORSOrigins, want)
+	}
+	if c.LogLevel != slog.LevelWarn || c.AppURL != "https://app.example.com" || !c.RequireAdmin2FA {
+		t.Errorf("LogLevel = %s, AppURL = %q, RequireAdmin2FA = %v", c.LogLevel, c.AppURL, c.RequireAdmin2FA)
+	}
+	if c.CourseRetention != 7*24*time.Hour {
+		t.Errorf("CourseRetention = %s", c.CourseRetention)
+	}
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	notDir := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(notDir, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"missing database", map[string]string{"DATABASE_URL": ""}, "DATABASE_URL is not set"},
+		{"bad integer", map[string]string{"DB_MAX_CONNS": "many"}, "DB_MAX_CONNS must be an integer of at least 1"},
+		{"integer below minimum", map[string]string{"DB_CONNECT_RETRIES": "0"}, "DB_CONNECT_RETRIES must be an integer of at least 1"},
+		{"min above max conns", map[string]string{"DB_MIN_CONNS": "5", "DB_MAX_CONNS": "2"}, "DB_MIN_CONNS (5) must not exceed DB_MAX_CONNS (2)"},
+		{"bad duration", map[string]string{"SERVER_READ_TIMEOUT": "soon"}, "SERVER_READ_TIMEOUT must be a positive duration"},
+		{"zero duration", map[string]string{"ACCESS_TOKEN_TTL": "0"}, "ACCESS_TOKEN_TTL must be a positive duration"},
+		{"negative duration", map[string]string{"DB_QUERY_TIMEOUT": "-1s"}, "DB_QUERY_TIMEOUT must be a positive duration"},
+		{"refresh shorter than access", map[string]string{"ACCESS_TOKEN_TTL": "2h", "REFRESH_TOKEN_TTL": "1h"}, "REFRESH_TOKEN_TTL (1h0m0s) must not be shorter than ACCESS_TOKEN_TTL (2h0m0s)"},
+		{"no JWT key", map[string]string{"JWT_SECRET": ""}, "no JWT signing key configured"},
+		{"missing JWT keys dir", map[string]string{"JWT_KEYS_DIR": filepath.Join(t.TempDir(), "missing")}, "JWT_KEYS_DIR"},
+		{"JWT keys dir is a file", map[string]string{"JWT_KEYS_DIR": notDir}, "is not a directory"},
+		{"keys dir without active kid", map[string]string{"JWT_SECRET": "", "JWT_KEYS_DIR": t.TempDir()}, "JWT_ACTIVE_KID must be set when JWT_SECRET is not"},
+		{"bad origin", map[string]string{"CORS_ORIGINS": "app.example.com"}, "CORS_ORIGINS entries must be"},
+		{"origin with path", map[string]string{"CORS_ORIGINS": "https://app.example.com/app"}, "CORS_ORIGINS entries must be"},
+		{"bad log level", map[string]string{"LOG_LEVEL": "loud"}, "LOG_LEVEL must be debug, info, warn or error"},
+		{"relative app URL", map[string]string{"APP_URL": "/app"}, "APP_URL must be an absolute http(s) URL"},
+		{"unknown mail driver", map[string]string{"MAIL_DRIVER": "pigeon"}, `unknown MAIL_DRIVER "pigeon"`},
+		{"smtp without host", map[string]string{"MAIL_DRIVER": "smtp", "MAIL_FROM": "a@example.com"}, "MAIL_DRIVER=smtp requires SMTP_HOST and MAIL_FROM"},
+		{"bad bool", map[string]string{"MIGRATE_ON_START": "sometimes"}, "MIGRATE_ON_START must be true or false"},
+		{"retention below a day", map[string]string{"COURSE_RETENTION_DAYS": "0"}, "COURSE_RETENTION_DAYS must be an integer of at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			c, err := Load()
+			if err == nil {
+				t.Fatalf("Load() = %+v, want error containing %q", c, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryInvalidSetting(t *testing.T) {
+	setEnv(t, map[string]string{
+		"DATABASE_URL": "",
+		"LOG_LEVEL":    "loud",
+		"APP_URL":      "ftp://example.com",
+	})
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load succeeded")
+	}
+	for _, want := range []string{"DATABASE_URL", "LOG_LEVEL", "APP_URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadReadsConfigFile(t *testing.T) {
+	setEnv(t, map[string]string{"DATABASE_URL": ""})
+	path := filepath.Join(t.TempDir(), "flexnative.env")
+	if err := os.WriteFile(path, []byte("DATABASE_URL=postgres://db/from-file\nLISTEN_ADDR=:9000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	// Blank variables are unset for Load but still block godotenv, which
+	// never overrides the environment.
+	os.Unsetenv("DATABASE_URL")
+	os.Unsetenv("LISTEN_ADDR")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.DB.URL != "postgres://db/from-file" || c.ListenAddr != ":9000" {
+		t.Errorf("DB.URL = %q, ListenAddr = %q", c.DB.URL, c.ListenAddr)
+	}
+}
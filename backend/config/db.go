@@ -3,7 +3,7 @@ package config
 import (
 	"context"
 	"log"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,30 +11,29 @@ import (
 
 var DB *pgxpool.Pool
 
-func ConnectDB() {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL is not set")
-	}
-
+// ConnectDB opens the pool described by c, retrying while the database
+// comes up. QueryTimeout is enforced server-side as statement_timeout;
+// requests additionally cancel their queries when the client goes away.
+func ConnectDB(c DBConfig) {
 	log.Println("Connecting to database...")
-	
-	config, err := pgxpool.ParseConfig(dbURL)
+
+	poolConfig, err := pgxpool.ParseConfig(c.URL)
 	if err != nil {
 		log.Fatalf("Unable to parse DATABASE_URL: %v", err)
 	}
-	
-	config.MaxConns = 10
-	config.MinConns = 1
-	config.MaxConnLifetime = time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
-	
+
+	poolConfig.MaxConns = c.MaxConns
+	poolConfig.MinConns = c.MinConns
+	poolConfig.MaxConnLifetime = c.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = c.MaxConnIdleTime
+	poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.QueryTimeout.Milliseconds(), 10)
+
 	var db *pgxpool.Pool
-	maxRetries := 5
-	retryDelay := 2 * time.Second
-	
+	maxRetries := c.ConnectRetries
+	retryDelay := c.ConnectRetryDelay
+
 	for i := 0; i < maxRetries; i++ {
-		db, err = pgxpool.NewWithConfig(context.Background(), config)
+		db, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
 		if err == nil {
 			err = db.Ping(context.Background())
 			if err == nil {
@@ -42,7 +41,7 @@ func ConnectDB() {
 				break
 			}
 		}
-		
+
 		if i < maxRetries-1 {
 			time.Sleep(retryDelay)
 			retryDelay *= 2
@@ -50,7 +49,7 @@ func ConnectDB() {
 			log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
 		}
 	}
-	
+
 	DB = db
 
 	var version string
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Self-service account endpoints. They act on the caller only; admins manage
+// other accounts through HandleUserOperations.
+
+// errInvalidPassword rolls back a transaction whose current password was
+// rejected; the caller answers with writeReauthFailure.
+var errInvalidPassword = errors.New("current password is incorrect")
+
+// checkCurrentPassword loads the caller's password hash and compares it. A
+// wrong password is errInvalidPassword.
+func checkCurrentPassword(ctx context.Context, users repository.UserRepository, userID int, password string) error {
+	hashed, err := users.PasswordHash(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading password: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) != nil {
+		return errInvalidPassword
+	}
+	return nil
+}
+
+// Wrong passwords and codes on the endpoints that ask for them again count
+// towards the same lockout as failed logins, so a stolen session cannot be
+// used to guess them.
+
+// checkReauthThrottle returns the caller's email, under which re-auth
+// failures are counted, or writes a response and returns false while the
+// account or the client IP is locked out.
+func checkReauthThrottle(w http.ResponseWriter, r *http.Request, store repository.Store, userID int) (string, bool) {
+	user, err := store.Users().Admin(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return "", false
+	}
+	blockedFor, err := loginBlockedFor(r.Context(), store.Throttles(), user.Email, clientIP(r))
+	if err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return "", false
+	}
+	if blockedFor > 0 {
+		writeTooManyRequests(w, blockedFor, "Too many failed attempts, please try again later")
+		return "", false
+	}
+	return user.Email, true
+}
+
+// writeReauthFailure answers a rejected password or code and counts it
+// against email. It reports whether err was one; call it once the
+// transaction err came from has rolled back.
+func writeReauthFailure(w http.ResponseWriter, r *http.Request, throttles repository.ThrottleRepository, email string, err error) bool {
+	switch {
+	case errors.Is(err, errInvalidPassword):
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidPassword, "Current password is incorrect", nil)
+	case errors.Is(err, errInvalidSecondFactor):
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidTwoFactor, "Invalid authentication code", nil)
+	default:
+		return false
+	}
+	if err := recordLoginFailure(r.Context(), throttles, email, clientIP(r)); err != nil {
+		log.Printf("Error recording failed re-authentication: %v", err)
+	}
+	return true
+}
+
+// checkUsername trims a submitted username in place and returns why it is
+// invalid, or "" when it is acceptable.
+func checkUsername(username *string) string {
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return "must not be empty"
+	}
+	return ""
+}
+
+// writeUniqueViolation answers 409 when err is a unique violation on the
+// users table, which happens when a concurrent request took the same
+// username or email after it was checked.
+func writeUniqueViolation(w http.ResponseWriter, err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return false
+	}
+	if strings.Contains(pgErr.ConstraintName, "email") {
+		writeAPIError(w, http.StatusConflict, errCodeEmailTaken, "Email sudah terdaftar", nil)
+	} else {
+		writeAPIError(w, http.StatusConflict, errCodeUsernameTaken, "Username sudah terdaftar", nil)
+	}
+	return true
+}
+
+// UpdateUserProfile handles PUT /api/user/profile. Only the fields present
+// in the body change. A new email must be verified again before the account
+// can log in or enroll.
+func (h *UserHandler) UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
+	p := middleware.MustPrincipal(r.Context())
+
+	var req struct {
+		Username *string `json:"username"`
+		Email    *string `json:"email"`
+		Status   *string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	fieldErrors := map[string]interface{}{}
+	if req.Username != nil {
+		if msg := checkUsername(req.Username); msg != "" {
+			fieldErrors["username"] = msg
+		}
+	}
+	if req.Email != nil {
+		*req.Email = normalizeEmail(*req.Email)
+		if !strings.Contains(*req.Email, "@") {
+			fieldErrors["email"] = "must be a valid email address"
+		}
+	}
+	if req.Status != nil && len(*req.Status) > 255 {
+		fieldErrors["status"] = "must be at most 255 characters"
+	}
+	if len(fieldErrors) > 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation, "Invalid profile", fieldErrors)
+		return
+	}
+
+	ctx := r.Context()
+	var username, email string
+	emailChanged := false
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		user, err := store.Users().Lock(ctx, p.ID)
+		if err != nil {
+			return fmt.Errorf("loading user: %w", err)
+		}
+		username, email = user.Username, user.Email
+
+		emailChanged = req.Email != nil && !strings.EqualFold(*req.Email, email)
+		if req.Username != nil && *req.Username != username {
+			taken, err := store.Users().UsernameTaken(ctx, *req.Username, p.ID)
+			if err != nil {
+				return fmt.Errorf("checking username: %w", err)
+			}
+			if taken {
+				writeAPIError(w, http.StatusConflict, errCodeUsernameTaken, "Username sudah terdaftar", nil)
+				return errResponseWritten
+			}
+		}
+		if emailChanged {
+			taken, err := store.Users().EmailTaken(ctx, *req.Email, p.ID)
+			if err != nil {
+				return fmt.Errorf("checking email: %w", err)
+			}
+			if taken {
+				writeAPIError(w, http.StatusConflict, errCodeEmailTaken, "Email sudah terdaftar", nil)
+				return errResponseWritten
+			}
+		}
+
+		err = store.Users().UpdateProfile(ctx, p.ID, models.ProfileUpdate{
+			Username: req.Username, Email: req.Email, Status: req.Status, ResetVerification: emailChanged,
+		})
+		if writeUniqueViolation(w, err) {
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("updating profile: %w", err)
+		}
+
+		before := map[string]interface{}{}
+		after := map[string]interface{}{}
+		if req.Username != nil && *req.Username != username {
+			before["username"], after["username"] = username, *req.Username
+		}
+		if emailChanged {
+			before["email"], after["email"] = email, *req.Email
+		}
+		if len(after) > 0 {
+			err = recordAudit(ctx, store.Audit(), r, auditEvent{
+				Action: "account.update", TargetType: "user", TargetID: p.ID, Before: before, After: after,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if emailChanged {
+			// Reset links sent to the old address must not work any more.
+			if err := store.PasswordResets().DiscardUnused(ctx, p.ID); err != nil {
+				return fmt.Errorf("clearing reset tokens: %w", err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating profile of user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if req.Username != nil {
+		username = *req.Username
+	}
+	if emailChanged {
+		email = *req.Email
+		log.Printf("User %d changed their email; verification required", p.ID)
+		inBackground(r, "sending verification email", func(ctx context.Context) error {
+			return sendVerificationEmail(ctx, p.ID, username, email)
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":              "Profile updated",
+		"username":             username,
+		"email":                email,
+		"verificationRequired": emailChanged,
+	})
+}
+
+// ChangePassword handles /api/user/password. Every session of the account is
+// revoked and the caller receives a fresh one.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "PUT" && r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	p := middleware.MustPrincipal(r.Context())
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CurrentPassword == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "currentPassword and newPassword are required", nil)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation, "Password is too short",
+			map[string]interface{}{"minLength": minPasswordLength})
+		return
+	}
+
+	email, ok := checkReauthThrottle(w, r, h.Store, p.ID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var session tokenResponse
+	var revoked int64
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		if err := checkCurrentPassword(ctx, store.Users(), p.ID, req.CurrentPassword); err != nil {
+			return err
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hashing password: %w", err)
+		}
+
+		user, err := store.Users().Admin(ctx, p.ID)
+		if err != nil {
+			return fmt.Errorf("loading user: %w", err)
+		}
+		if err := store.Users().SetPassword(ctx, p.ID, string(hashedPassword)); err != nil {
+			return fmt.Errorf("updating password: %w", err)
+		}
+		if revoked, err = store.Sessions().RevokeUser(ctx, p.ID, "password_change"); err != nil {
+			return fmt.Errorf("revoking sessions: %w", err)
+		}
+		err = recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "password.change", TargetType: "user", TargetID: p.ID,
+			After: map[string]int64{"sessionsRevoked": revoked},
+		})
+		if err != nil {
+			return err
+		}
+		session, err = issueSession(ctx, store.Sessions(), r, p.ID, user.Username, user.Role, "", p.MFA)
+		if err != nil {
+			return fmt.Errorf("issuing session: %w", err)
+		}
+		return nil
+	})
+	if writeReauthFailure(w, r, h.Store.Throttles(), email, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error changing password for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("User %d changed their password; revoked %d refresh tokens", p.ID, revoked)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// DeleteAccount handles DELETE /api/user. The current password confirms the
+// closure; the account is then removed exactly like an admin delete.
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "DELETE" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	p := middleware.MustPrincipal(r.Context())
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "password is required", nil)
+		return
+	}
+
+	email, ok := checkReauthThrottle(w, r, h.Store, p.ID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		if err := checkCurrentPassword(ctx, store.Users(), p.ID, req.Password); err != nil {
+			return err
+		}
+
+		before, err := loadAdminUser(ctx, store.Users(), p.ID)
+		if err != nil {
+			return err
+		}
+		if err := store.Users().Delete(ctx, p.ID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "account.close", TargetType: "user", TargetID: p.ID, Before: before,
+		})
+	})
+	if writeReauthFailure(w, r, h.Store.Throttles(), email, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting account %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+
+	log.Printf("User %d closed their account", p.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
@@ -1,47 +1,36 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
-	"backend/config"
-	"backend/utils"
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
 )
 
-func RecordActivity(w http.ResponseWriter, r *http.Request) {
-    enableCORS(w)
+// recentActivityWindow is how long a repeated activity of the same kind
+// refreshes the earlier one instead of adding a new entry.
+const recentActivityWindow = 5 * time.Minute
+
+// ActivityHandler records and lists a learner's recent activity.
+type ActivityHandler struct {
+    Courses    repository.CourseRepository
+    Activities repository.ActivityRepository
+}
+
+func (h *ActivityHandler) RecordActivity(w http.ResponseWriter, r *http.Request) {
     if r.Method == "OPTIONS" {
         return
     }
 
-    log.Println("RecordActivity handler called")
+    slog.Debug("RecordActivity handler called")
 
-    authHeader := r.Header.Get("Authorization")
-    if !strings.HasPrefix(authHeader, "Bearer ") {
-        log.Println("Unauthorized: No Bearer token")
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
-    tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-    
-    claims, err := utils.VerifyToken(tokenString)
-    if err != nil {
-        log.Printf("Unauthorized: Invalid token: %v", err)
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
-    
-    userIDFloat, ok := claims["user_id"].(float64)
-    if !ok {
-        log.Println("Invalid user ID in token claims")
-        http.Error(w, "Invalid user ID", http.StatusBadRequest)
-        return
-    }
-    userID := int(userIDFloat)
+    userID := middleware.MustPrincipal(r.Context()).ID
 
     var req struct {
         CourseID int    `json:"courseId"`
@@ -57,59 +46,33 @@ func RecordActivity(w http.ResponseWriter, r *http.Request) {
     log.Printf("Recording activity for user ID: %d, course ID: %d, type: %s", 
         userID, req.CourseID, req.Type)
 
-    var courseTitle string
-    err = config.DB.QueryRow(context.Background(), 
-        "SELECT title FROM courses WHERE id = $1", req.CourseID).Scan(&courseTitle)
-    
+    courseTitle, err := h.Courses.Title(r.Context(), req.CourseID)
+    if errors.Is(err, repository.ErrNotFound) {
+        writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+            map[string]interface{}{"courseId": req.CourseID})
+        return
+    }
     if err != nil {
         log.Printf("Error getting course title: %v", err)
         http.Error(w, "Failed to record activity", http.StatusInternalServerError)
         return
     }
 
-    var existingActivity bool
-    err = config.DB.QueryRow(context.Background(), `
-        SELECT EXISTS(
-            SELECT 1 FROM user_activities 
-            WHERE user_id = $1 
-            AND course_id = $2 
-            AND type = $3 
-            AND created_at > NOW() - INTERVAL '5 minutes'
-        )
-    `, userID, req.CourseID, req.Type).Scan(&existingActivity)
-
+    touched, err := h.Activities.Touch(r.Context(), userID, req.CourseID, req.Type, recentActivityWindow)
     if err != nil {
-        log.Printf("Error checking existing activity: %v", err)
+        log.Printf("Error updating activity timestamp: %v", err)
     }
 
-    if existingActivity {
-        log.Printf("Similar activity already exists, updating timestamp")
-        _, err = config.DB.Exec(context.Background(), `
-            UPDATE user_activities 
-            SET created_at = NOW() 
-            WHERE user_id = $1 
-            AND course_id = $2 
-            AND type = $3 
-            AND created_at > NOW() - INTERVAL '5 minutes'
-            AND id IN (
-                SELECT id FROM user_activities
-                WHERE user_id = $1 
-                AND course_id = $2 
-                AND type = $3 
-                AND created_at > NOW() - INTERVAL '5 minutes'
-                ORDER BY created_at DESC
-                LIMIT 1
-            )
-        `, userID, req.CourseID, req.Type)
-
-        if err != nil {
-            log.Printf("Error updating activity timestamp: %v", err)
-        }
+    if touched {
+        log.Printf("Similar activity already exists, updated timestamp")
     } else {
-        _, err = config.DB.Exec(context.Background(), `
-            INSERT INTO user_activities (user_id, course_id, title, type, created_at)
-            VALUES ($1, $2, $3, $4, $5)
-        `, userID, req.CourseID, courseTitle, req.Type, time.Now())
+        err = h.Activities.Create(r.Context(), models.Activity{
+            UserID:    userID,
+            CourseID:  req.CourseID,
+            Title:     courseTitle,
+            Type:      req.Type,
+            CreatedAt: time.Now(),
+        })
 
         if err != nil {
             log.Printf("Error recording activity: %v", err)
@@ -127,6 +90,35 @@ func RecordActivity(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(response)
 }
 
-
-
-
+func (h *ActivityHandler) GetUserActivities(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	slog.Debug("GetUserActivities handler called")
+
+	userID := middleware.MustPrincipal(r.Context()).ID
+
+	recent, err := h.Activities.Recent(r.Context(), userID, 10)
+	if err != nil {
+		log.Printf("Error querying activities: %v", err)
+		http.Error(w, "Failed to fetch activities", http.StatusInternalServerError)
+		return
+	}
+
+	var activities []map[string]interface{}
+	for _, a := range recent {
+		activities = append(activities, map[string]interface{}{
+			"id":       a.ID,
+			"courseId": a.CourseID,
+			"title":    a.Title,
+			"type":     a.Type,
+			"date":     a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	log.Printf("Found %d activities for user ID: %d", len(activities), userID)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activities)
+}
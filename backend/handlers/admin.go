@@ -4,67 +4,47 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
-	"backend/config"
-	"backend/utils"
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
 )
 
-func AdminCourseHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+func (h *CourseHandler) AdminCourseHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		log.Println("Missing or invalid Authorization header")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Unauthorized: Invalid token format"})
-		return
-	}
-	
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := utils.VerifyToken(tokenStr)
-	if err != nil {
-		log.Printf("Token verification failed: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Unauthorized: Invalid token"})
-		return
-	}
-	
-	role, ok := claims["role"].(string)
-	if !ok || role != "admin" {
-		log.Printf("User does not have admin role. Role: %v", role)
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Forbidden: Admin role required"})
-		return
-	}
-	
+
 	switch r.Method {
 	case "GET":
-		GetCourses(w, r)
+		if r.URL.Query().Get("archived") == "true" {
+			h.listArchivedCourses(w, r)
+			return
+		}
+		h.GetCourses(w, r)
 	case "POST":
-		AddCourse(w, r)
+		h.AddCourse(w, r)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Method not allowed"})
 	}
 }
 
-func AddCourse(w http.ResponseWriter, r *http.Request) {
-	log.Println("AddCourse handler called")
-	
+func (h *CourseHandler) AddCourse(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("AddCourse handler called")
+
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("Error reading request body: %v", err)
@@ -72,33 +52,35 @@ func AddCourse(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Error reading request body"})
 		return
 	}
-	
+
 	log.Printf("Raw request body: %s", string(bodyBytes))
-	
+
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-	
+
 	var req struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Level       string `json:"level"`
-		Duration    string `json:"duration"`
-		Instructor  string `json:"instructor"`
-		VideoUrl    string `json:"videoUrl"`
-		Modules     []struct {
+		Title            string `json:"title"`
+		Description      string `json:"description"`
+		Level            string `json:"level"`
+		Duration         string `json:"duration"`
+		Instructor       string `json:"instructor"`
+		VideoUrl         string `json:"videoUrl"`
+		TemplateID       int    `json:"templateId"`
+		UseLevelTemplate bool   `json:"useLevelTemplate"`
+		Modules          []struct {
 			Title    string `json:"title"`
 			Content  string `json:"content"`
 			Order    int    `json:"order"`
 			VideoUrl string `json:"videoUrl"`
 		} `json:"modules"`
 	}
-	
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Error decoding request body: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid request format: " + err.Error()})
 		return
 	}
-	
+
 	log.Printf("Parsed request: %+v", req)
 	log.Printf("Number of modules: %d", len(req.Modules))
 
@@ -109,179 +91,132 @@ func AddCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var tableExists bool
-	err = config.DB.QueryRow(context.Background(), `
-		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public' 
-			AND table_name = 'courses'
-		)
-	`).Scan(&tableExists)
-	
-	if err != nil {
-		log.Printf("Error checking if courses table exists: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
-		return
-	}
+	var template *models.CourseTemplate
+	if req.TemplateID != 0 || req.UseLevelTemplate {
+		if len(req.Modules) > 0 {
+			writeJSONError(w, http.StatusBadRequest, "Provide either modules or a template, not both")
+			return
+		}
 
-	if !tableExists {
-		log.Println("Courses table does not exist, creating it")
-		_, err = config.DB.Exec(context.Background(), `
-			CREATE TABLE courses (
-				id SERIAL PRIMARY KEY,
-				title VARCHAR(255) NOT NULL,
-				description TEXT NOT NULL,
-				level VARCHAR(50) DEFAULT 'beginner',
-				duration VARCHAR(100),
-				instructor VARCHAR(255),
-				video_url VARCHAR(255),
-				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-			)
-		`)
-		
-		if err != nil {
-			log.Printf("Error creating courses table: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
+		var t models.CourseTemplate
+		if req.TemplateID != 0 {
+			t, err = h.Store.Templates().Get(r.Context(), req.TemplateID)
+		} else {
+			t, err = h.Store.Templates().ForLevel(r.Context(), req.Level)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Course template not found")
 			return
 		}
-	}
-	
-	err = config.DB.QueryRow(context.Background(), `
-		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public' 
-			AND table_name = 'course_modules'
-		)
-	`).Scan(&tableExists)
-	
-	if err != nil {
-		log.Printf("Error checking if course_modules table exists: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
-		return
-	}
-	
-	if !tableExists {
-		log.Println("Course_modules table does not exist, creating it")
-		_, err = config.DB.Exec(context.Background(), `
-			CREATE TABLE course_modules (
-				id SERIAL PRIMARY KEY,
-				course_id INTEGER,
-				title VARCHAR(255) NOT NULL,
-				content TEXT,
-				description TEXT,
-				video_url VARCHAR(255),
-				module_order INTEGER DEFAULT 1,
-				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-			)
-		`)
-		
 		if err != nil {
-			log.Printf("Error creating course_modules table: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
+			log.Printf("Error loading course template: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error: "+err.Error())
 			return
 		}
+		template = &t
 	}
 
-	var courseID int
-	err = config.DB.QueryRow(context.Background(), `
-		INSERT INTO courses (title, description, level, duration, instructor, video_url)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
-	`, req.Title, req.Description, req.Level, req.Duration, req.Instructor, req.VideoUrl).Scan(&courseID)
-	
-	if err != nil {
-		log.Printf("Error inserting course: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Failed to create course: " + err.Error()})
-		return
-	}
-	
-	log.Printf("Course inserted with ID: %d", courseID)
-	
-	var moduleErrors []string
-	for i, module := range req.Modules {
-		if module.Title == "" {
-			log.Printf("Skipping empty module at index %d", i)
-			continue
-		}
-		
-		log.Printf("Inserting module: %+v", module)
-		
-		_, err = config.DB.Exec(context.Background(), `
-			INSERT INTO course_modules (course_id, title, content, module_order, video_url)
-			VALUES ($1, $2, $3, $4, $5)
-		`, courseID, module.Title, module.Content, module.Order, module.VideoUrl)
-		
+	ownerID := middleware.MustPrincipal(r.Context()).ID
+
+	var courseID, moduleCount int
+	// Modules, the template and the audit entry are written in the same
+	// transaction as the course, so a failure leaves nothing behind.
+	err = h.Store.WithTx(r.Context(), func(store repository.Store) error {
+		var err error
+		courseID, err = store.Courses().Create(r.Context(), models.Course{
+			Title: req.Title, Description: req.Description, Level: req.Level, Duration: req.Duration,
+			Instructor: req.Instructor, VideoUrl: req.VideoUrl, OwnerID: &ownerID,
+		})
 		if err != nil {
-			log.Printf("Error inserting module: %v", err)
-			moduleErrors = append(moduleErrors, fmt.Sprintf("Module %d: %v", i+1, err))
+			return err
 		}
+
+		for i, module := range req.Modules {
+			if module.Title == "" {
+				log.Printf("Skipping empty module at index %d", i)
+				continue
+			}
+
+			order := module.Order
+			if order <= 0 {
+				order = i + 1
+			}
+
+			_, err = store.Modules().Create(r.Context(), models.CourseModule{
+				CourseID: courseID, Title: module.Title, Content: module.Content, Order: order, VideoUrl: module.VideoUrl,
+			})
+			if err != nil {
+				return fmt.Errorf("module %d: %w", i+1, err)
+			}
+			moduleCount++
+		}
+
+		after := map[string]interface{}{
+			"title":       req.Title,
+			"description": req.Description,
+			"level":       req.Level,
+			"duration":    req.Duration,
+			"instructor":  req.Instructor,
+			"videoUrl":    req.VideoUrl,
+			"ownerId":     ownerID,
+		}
+		if template != nil {
+			ids, err := applyTemplate(r.Context(), store.Modules(), courseID, req.Title, *template)
+			if err != nil {
+				return fmt.Errorf("template %s: %w", template.Name, err)
+			}
+			log.Printf("Applied template %d (%s): %d modules", template.ID, template.Name, len(ids))
+			moduleCount += len(ids)
+			after["templateId"] = template.ID
+		}
+		after["modules"] = moduleCount
+
+		if err := store.Modules().Renumber(r.Context(), courseID); err != nil {
+			return err
+		}
+
+		return recordAudit(r.Context(), store.Audit(), r, auditEvent{
+			Action: "course.create", TargetType: "course", TargetID: courseID, After: after,
+		})
+	})
+	if err != nil {
+		log.Printf("Error creating course: %v", err)
+		writeCourseCreateError(w, err)
+		return
 	}
-	
-	log.Println("Course added successfully")
-	
+
+	log.Printf("Course %d added with %d modules", courseID, moduleCount)
+
 	w.WriteHeader(http.StatusCreated)
-	response := map[string]interface{}{
-		"message": "Course added successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Course added successfully",
 		"courseId": courseID,
-	}
-	
-	if len(moduleErrors) > 0 {
-		response["warnings"] = moduleErrors
-	}
-	
-	json.NewEncoder(w).Encode(response)
+	})
 }
-func AdminCourseByID(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+func writeCourseCreateError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Failed to create course: " + err.Error()})
+}
+
+func (h *CourseHandler) AdminCourseByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		log.Println("Missing or invalid Authorization header")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Unauthorized: Invalid token format"})
-		return
-	}
-	
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := utils.VerifyToken(tokenStr)
-	if err != nil {
-		log.Printf("Token verification failed: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Unauthorized: Invalid token"})
-		return
-	}
-	
-	role, ok := claims["role"].(string)
-	if !ok || role != "admin" {
-		log.Printf("User does not have admin role. Role: %v", role)
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Forbidden: Admin role required"})
-		return
-	}
-	
+
 	path := r.URL.Path
 	parts := strings.Split(path, "/")
-	if len(parts) < 4 {
-		log.Println("Invalid course ID: path parts less than 4")
+	if len(parts) < 5 {
+		log.Println("Invalid course ID: path parts less than 5")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid course ID"})
 		return
 	}
-	
-	courseIDStr := parts[len(parts)-1]
+
+	courseIDStr := parts[4]
 	courseID, err := strconv.Atoi(courseIDStr)
 	if err != nil {
 		log.Printf("Invalid course ID: %v", err)
@@ -289,87 +224,99 @@ func AdminCourseByID(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid course ID"})
 		return
 	}
-	
+
 	log.Printf("Processing request for course ID: %d", courseID)
-	
+
+	// Reads go through the same check, since the admin view also shows
+	// archived courses.
+	if !h.authorizeCourseWrite(w, r, courseID) {
+		return
+	}
+
+	if len(parts) > 5 && parts[5] != "" {
+		switch parts[5] {
+		case "modules":
+			h.handleCourseModules(w, r, courseID, parts[6:])
+		case "restore":
+			if r.Method != "POST" {
+				writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			h.restoreCourse(w, r, courseID)
+		default:
+			writeJSONError(w, http.StatusNotFound, "Not found")
+		}
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		getCourseByID(w, r, courseID)
 	case "PUT":
-		updateCourse(w, r, courseID)
+		h.updateCourse(w, r, courseID)
 	case "DELETE":
-		deleteCourse(w, r, courseID)
+		h.archiveCourse(w, r, courseID)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Method not allowed"})
 	}
 }
-func deleteCourse(w http.ResponseWriter, r *http.Request, courseID int) {
-	log.Printf("Deleting course with ID: %d", courseID)
-	
-	tx, err := config.DB.Begin(context.Background())
-	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
-		return
-	}
-	defer tx.Rollback(context.Background())
-	
-	var exists bool
-	err = tx.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM courses WHERE id = $1)", courseID).Scan(&exists)
-	if err != nil {
-		log.Printf("Error checking if course exists: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
-		return
-	}
-	
-	if !exists {
-		log.Printf("Course with ID %d not found", courseID)
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Course not found"})
-		return
+
+// authorizeCourseWrite checks that the caller may modify courseID: either
+// their role lifts the ownership restriction or they own the course. It
+// writes the error response itself when the check fails.
+func (h *CourseHandler) authorizeCourseWrite(w http.ResponseWriter, r *http.Request, courseID int) bool {
+	p := middleware.MustPrincipal(r.Context())
+	if p.Can(middleware.PermCourseWriteAny) {
+		return true
 	}
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM course_modules WHERE course_id = $1", courseID)
+	course, err := h.Store.Courses().Find(r.Context(), courseID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+			map[string]interface{}{"courseId": courseID})
+		return false
+	}
 	if err != nil {
-		log.Printf("Error deleting course modules: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Failed to delete course modules: " + err.Error()})
-		return
+		log.Printf("Error loading owner of course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return false
 	}
-	
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM completed_modules WHERE course_id = $1", courseID)
-	if err != nil {
-		log.Printf("Error deleting completed modules: %v", err)
+	if course.OwnerID == nil || *course.OwnerID != p.ID {
+		log.Printf("User %d denied write access to course %d", p.ID, courseID)
+		writeAPIError(w, http.StatusForbidden, errCodeNotCourseOwner, "You can only edit courses you own",
+			map[string]interface{}{"courseId": courseID})
+		return false
 	}
+	return true
+}
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM user_courses WHERE course_id = $1", courseID)
+// courseSnapshot returns the course fields recorded in the audit log, or
+// repository.ErrNotFound.
+func courseSnapshot(ctx context.Context, store repository.Store, courseID int) (map[string]interface{}, error) {
+	c, err := store.Courses().Find(ctx, courseID)
 	if err != nil {
-		log.Printf("Error deleting user courses: %v", err)
+		return nil, err
 	}
-	
-	_, err = tx.Exec(context.Background(), "DELETE FROM courses WHERE id = $1", courseID)
+	modules, err := store.Modules().Count(ctx, courseID)
 	if err != nil {
-		log.Printf("Error deleting course: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Failed to delete course: " + err.Error()})
-		return
-	}
-	
-	if err = tx.Commit(context.Background()); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Database error: " + err.Error()})
-		return
-	}
-	
-	log.Printf("Course with ID %d deleted successfully", courseID)
-	
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Course deleted successfully"})
+		return nil, err
+	}
+	snapshot := map[string]interface{}{
+		"title":       c.Title,
+		"description": c.Description,
+		"level":       c.Level,
+		"duration":    c.Duration,
+		"instructor":  c.Instructor,
+		"videoUrl":    c.VideoUrl,
+		"ownerId":     c.OwnerID,
+		"modules":     modules,
+	}
+	if c.ArchivedAt != nil {
+		snapshot["archivedAt"] = formatTimestamp(c.ArchivedAt)
+	}
+	return snapshot, nil
 }
 
 func getCourseByID(w http.ResponseWriter, r *http.Request, courseID int) {
@@ -377,13 +324,224 @@ func getCourseByID(w http.ResponseWriter, r *http.Request, courseID int) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Get course by ID not implemented yet"})
 }
 
-func updateCourse(w http.ResponseWriter, r *http.Request, courseID int) {
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Update course not implemented yet"})
+type courseModuleInput struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	VideoUrl    string `json:"videoUrl"`
+	Order       int    `json:"order"`
 }
 
+func (h *CourseHandler) updateCourse(w http.ResponseWriter, r *http.Request, courseID int) {
+	log.Printf("Updating course with ID: %d", courseID)
 
+	var req struct {
+		Title       *string              `json:"title"`
+		Description *string              `json:"description"`
+		Level       *string              `json:"level"`
+		Duration    *string              `json:"duration"`
+		Instructor  *string              `json:"instructor"`
+		VideoUrl    *string              `json:"videoUrl"`
+		Modules     *[]courseModuleInput `json:"modules"`
+	}
 
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
 
+	if (req.Title != nil && strings.TrimSpace(*req.Title) == "") ||
+		(req.Description != nil && strings.TrimSpace(*req.Description) == "") {
+		writeJSONError(w, http.StatusBadRequest, "Title and description cannot be empty")
+		return
+	}
 
+	ctx := r.Context()
+	changedFields := []string{}
+	added := []int{}
+	updated := []int{}
+	reordered := []int{}
+	removed := []int{}
+	var progressRemoved int64
 
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		current, err := store.Courses().Lock(ctx, courseID)
+		if errors.Is(err, repository.ErrNotFound) {
+			log.Printf("Course with ID %d not found", courseID)
+			writeJSONError(w, http.StatusNotFound, "Course not found")
+			return errResponseWritten
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.ArchivedAt != nil {
+			writeCourseArchived(w, courseID)
+			return errResponseWritten
+		}
+
+		next := current
+		fields := []struct {
+			name   string
+			field  *string
+			newVal *string
+		}{
+			{"title", &next.Title, req.Title},
+			{"description", &next.Description, req.Description},
+			{"level", &next.Level, req.Level},
+			{"duration", &next.Duration, req.Duration},
+			{"instructor", &next.Instructor, req.Instructor},
+			{"videoUrl", &next.VideoUrl, req.VideoUrl},
+		}
+
+		before := map[string]interface{}{}
+		after := map[string]interface{}{}
+		for _, f := range fields {
+			if f.newVal == nil || *f.newVal == *f.field {
+				continue
+			}
+			before[f.name] = *f.field
+			after[f.name] = *f.newVal
+			*f.field = *f.newVal
+			changedFields = append(changedFields, f.name)
+		}
+
+		if len(changedFields) > 0 {
+			if err := store.Courses().Update(ctx, next); err != nil {
+				return fmt.Errorf("updating course: %w", err)
+			}
+		}
+
+		if req.Modules != nil {
+			current, err := store.Modules().Lock(ctx, courseID)
+			if err != nil {
+				return fmt.Errorf("loading modules: %w", err)
+			}
+			existing := map[int]models.CourseModule{}
+			for _, m := range current {
+				existing[m.ID] = m
+			}
+
+			seen := map[int]bool{}
+			for i, module := range *req.Modules {
+				msg := ""
+				switch {
+				case strings.TrimSpace(module.Title) == "":
+					msg = fmt.Sprintf("Module %d: title is required", i+1)
+				case module.ID == 0:
+					continue
+				case existing[module.ID].ID == 0:
+					msg = fmt.Sprintf("Module %d does not belong to course %d", module.ID, courseID)
+				case seen[module.ID]:
+					msg = fmt.Sprintf("Module %d is listed more than once", module.ID)
+				}
+				if msg != "" {
+					writeJSONError(w, http.StatusBadRequest, msg)
+					return errResponseWritten
+				}
+				seen[module.ID] = true
+			}
+
+			for id := range existing {
+				if !seen[id] {
+					removed = append(removed, id)
+				}
+			}
+			sort.Ints(removed)
+
+			if len(removed) > 0 {
+				if progressRemoved, err = store.Modules().Delete(ctx, courseID, removed); err != nil {
+					return fmt.Errorf("removing modules: %w", err)
+				}
+			}
+
+			for i, module := range *req.Modules {
+				order := module.Order
+				if order == 0 {
+					order = i + 1
+				}
+				m := models.CourseModule{
+					ID: module.ID, CourseID: courseID, Title: module.Title, Description: module.Description,
+					Content: module.Content, VideoUrl: module.VideoUrl, Order: order,
+				}
+
+				if module.ID == 0 {
+					moduleID, err := store.Modules().Create(ctx, m)
+					if err != nil {
+						return fmt.Errorf("module %d: %w", i+1, err)
+					}
+					added = append(added, moduleID)
+					continue
+				}
+
+				old := existing[module.ID]
+				contentChanged := old.Title != module.Title || old.Description != module.Description ||
+					old.Content != module.Content || old.VideoUrl != module.VideoUrl
+				if !contentChanged && old.Order == order {
+					continue
+				}
+
+				if err := store.Modules().Update(ctx, m); err != nil {
+					return fmt.Errorf("module %d: %w", i+1, err)
+				}
+				if contentChanged {
+					updated = append(updated, module.ID)
+				}
+			}
+
+			if err := store.Modules().Renumber(ctx, courseID); err != nil {
+				return fmt.Errorf("renumbering modules: %w", err)
+			}
+
+			renumbered, err := store.Modules().ForCourse(ctx, courseID)
+			if err != nil {
+				return fmt.Errorf("loading module order: %w", err)
+			}
+			for _, m := range renumbered {
+				if old, ok := existing[m.ID]; ok && old.Order != m.Order {
+					reordered = append(reordered, m.ID)
+				}
+			}
+
+			after["modules"] = map[string]interface{}{
+				"added":     added,
+				"updated":   updated,
+				"reordered": reordered,
+				"removed":   removed,
+			}
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "course.update", TargetType: "course", TargetID: courseID, Before: before, After: after,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update course: "+err.Error())
+		return
+	}
+
+	log.Printf("Course %d updated: fields=%v added=%v updated=%v reordered=%v removed=%v",
+		courseID, changedFields, added, updated, reordered, removed)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Course updated successfully",
+		"courseId": courseID,
+		"changes": map[string]interface{}{
+			"fields": changedFields,
+			"modules": map[string]interface{}{
+				"added":     added,
+				"updated":   updated,
+				"reordered": reordered,
+				"removed":   removed,
+			},
+			"progressRemoved": progressRemoved,
+		},
+	})
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+	"backend/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultUserPageSize = 100
+	maxUserPageSize     = 500
+)
+
+// loadAdminUser returns the admin view of one account, or
+// repository.ErrNotFound.
+func loadAdminUser(ctx context.Context, users repository.UserRepository, userID int) (map[string]interface{}, error) {
+	u, err := users.Admin(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := map[string]interface{}{
+		"id":                u.ID,
+		"email":             u.Email,
+		"username":          u.Username,
+		"role":              u.Role,
+		"status":            u.Status,
+		"progress":          u.Progress,
+		"completed_courses": u.CompletedCourses,
+		"emailVerified":     u.EmailVerifiedAt != nil,
+		"suspended":         u.SuspendedAt != nil,
+		"twoFactorEnabled":  u.TwoFactorEnabled,
+	}
+	if u.EmailVerifiedAt != nil {
+		user["emailVerifiedAt"] = formatTimestamp(u.EmailVerifiedAt)
+	}
+	if u.SuspendedAt != nil {
+		user["suspendedAt"] = formatTimestamp(u.SuspendedAt)
+		user["suspendedReason"] = u.SuspendedReason
+	}
+	return user, nil
+}
+
+func (h *UserHandler) writeAdminUser(w http.ResponseWriter, r *http.Request, status int, userID int) {
+	user, err := loadAdminUser(r.Context(), h.Store.Users(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found",
+			map[string]interface{}{"userId": userID})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(user)
+}
+
+// createUser handles POST /api/admin/users. Without a password the account
+// gets an unusable one and the user is emailed a reset link to choose their
+// own. emailVerified skips the verification email.
+func (h *UserHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username      string `json:"username"`
+		Email         string `json:"email"`
+		Password      string `json:"password"`
+		Role          string `json:"role"`
+		EmailVerified bool   `json:"emailVerified"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = normalizeEmail(req.Email)
+	if req.Role == "" {
+		req.Role = middleware.RoleLearner
+	}
+
+	fieldErrors := map[string]interface{}{}
+	if req.Username == "" {
+		fieldErrors["username"] = "is required"
+	}
+	if !strings.Contains(req.Email, "@") {
+		fieldErrors["email"] = "must be a valid email address"
+	}
+	if req.Password != "" && len(req.Password) < minPasswordLength {
+		fieldErrors["password"] = "is too short"
+	}
+	if !middleware.ValidRole(req.Role) {
+		fieldErrors["role"] = "is not a valid role"
+	}
+	if len(fieldErrors) > 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation, "Invalid user", fieldErrors)
+		return
+	}
+
+	ctx := r.Context()
+	emailTaken, err := h.Store.Users().EmailTaken(ctx, req.Email, 0)
+	var usernameTaken bool
+	if err == nil {
+		usernameTaken, err = h.Store.Users().UsernameTaken(ctx, req.Username, 0)
+	}
+	if err != nil {
+		log.Printf("Error checking for existing users: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if emailTaken {
+		writeAPIError(w, http.StatusConflict, errCodeEmailTaken, "Email sudah terdaftar", nil)
+		return
+	}
+	if usernameTaken {
+		writeAPIError(w, http.StatusConflict, errCodeUsernameTaken, "Username sudah terdaftar", nil)
+		return
+	}
+
+	password := req.Password
+	if password == "" {
+		password, _, err = utils.GenerateOpaqueToken()
+		if err != nil {
+			log.Printf("Error generating password: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Server error")
+			return
+		}
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	var userID int
+	err = h.Store.WithTx(ctx, func(store repository.Store) error {
+		var err error
+		userID, err = store.Users().Create(ctx, models.NewUser{
+			Username:      req.Username,
+			Email:         req.Email,
+			PasswordHash:  string(hashedPassword),
+			Role:          req.Role,
+			EmailVerified: req.EmailVerified,
+		})
+		if writeUniqueViolation(w, err) {
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("inserting user: %w", err)
+		}
+
+		after, err := loadAdminUser(ctx, store.Users(), userID)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "user.create", TargetType: "user", TargetID: userID, After: after,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	admin := middleware.MustPrincipal(r.Context())
+	log.Printf("Admin %d created user %d (%s) with role %s", admin.ID, userID, req.Email, req.Role)
+
+	if !req.EmailVerified {
+		inBackground(r, "sending verification email", func(ctx context.Context) error {
+			return sendVerificationEmail(ctx, userID, req.Username, req.Email)
+		})
+	}
+	if req.Password == "" {
+		ip := clientIP(r)
+		inBackground(r, "sending password setup link", func(ctx context.Context) error {
+			return sendPasswordReset(ctx, h.Store, ip, req.Email)
+		})
+	}
+
+	h.writeAdminUser(w, r, http.StatusCreated, userID)
+}
+
+// handleUserAction serves POST /api/admin/users/{id}/{action} for role,
+// suspend, reactivate and password-reset.
+func (h *UserHandler) handleUserAction(w http.ResponseWriter, r *http.Request, userID int, action string) {
+	if r.Method != "POST" && r.Method != "PUT" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	admin := middleware.MustPrincipal(r.Context())
+	if userID == admin.ID && (action == "role" || action == "suspend") {
+		writeAPIError(w, http.StatusConflict, errCodeSelfModification,
+			"Admins cannot change their own role or suspend themselves", nil)
+		return
+	}
+
+	var req struct {
+		Role               string `json:"role"`
+		Reason             string `json:"reason"`
+		InvalidatePassword bool   `json:"invalidatePassword"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var email string
+	sendReset := false
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		user, err := store.Users().Lock(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found",
+				map[string]interface{}{"userId": userID})
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading user: %w", err)
+		}
+		email = user.Email
+		before, err := loadAdminUser(ctx, store.Users(), userID)
+		if err != nil {
+			return fmt.Errorf("loading user: %w", err)
+		}
+
+		var auditAction string
+		switch action {
+		case "role":
+			if !middleware.ValidRole(req.Role) {
+				writeAPIError(w, http.StatusUnprocessableEntity, errCodeInvalidRole, "Unknown role",
+					map[string]interface{}{"role": req.Role})
+				return errResponseWritten
+			}
+			err = store.Users().SetRole(ctx, userID, req.Role)
+			auditAction = "user.role_change"
+			log.Printf("Admin %d set role of user %d to %s", admin.ID, userID, req.Role)
+		case "suspend":
+			err = store.Users().Suspend(ctx, userID, req.Reason)
+			if err == nil {
+				_, err = store.Sessions().RevokeUser(ctx, userID, "suspended")
+			}
+			auditAction = "user.suspend"
+			log.Printf("Admin %d suspended user %d", admin.ID, userID)
+		case "reactivate":
+			err = store.Users().Reactivate(ctx, userID)
+			auditAction = "user.reactivate"
+			log.Printf("Admin %d reactivated user %d", admin.ID, userID)
+		case "password-reset":
+			// Sessions end now; the old password keeps working until the user
+			// picks a new one unless invalidatePassword is set.
+			if req.InvalidatePassword {
+				var hashed []byte
+				unusable, _, err := utils.GenerateOpaqueToken()
+				if err == nil {
+					hashed, err = bcrypt.GenerateFromPassword([]byte(unusable), bcrypt.DefaultCost)
+				}
+				if err != nil {
+					return fmt.Errorf("generating password: %w", err)
+				}
+				if err := store.Users().SetPassword(ctx, userID, string(hashed)); err != nil {
+					return err
+				}
+			}
+			_, err = store.Sessions().RevokeUser(ctx, userID, "admin_password_reset")
+			sendReset = true
+			auditAction = "user.password_reset"
+			log.Printf("Admin %d forced a password reset for user %d", admin.ID, userID)
+		default:
+			writeJSONError(w, http.StatusNotFound, "Not found")
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("applying %s: %w", action, err)
+		}
+
+		after, err := loadAdminUser(ctx, store.Users(), userID)
+		if err != nil {
+			return err
+		}
+		if sendReset {
+			after["passwordInvalidated"] = req.InvalidatePassword
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: auditAction, TargetType: "user", TargetID: userID, Before: before, After: after,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error applying %s to user %d: %v", action, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if sendReset {
+		ip := clientIP(r)
+		inBackground(r, "sending password reset", func(ctx context.Context) error {
+			return sendPasswordReset(ctx, h.Store, ip, email)
+		})
+	}
+
+	h.writeAdminUser(w, r, http.StatusOK, userID)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+)
+
+// The audit log records who changed what. Entries are written with the same
+// transaction as the change they describe, so a rolled back change leaves no
+// entry and a committed one always has its entry. Actions are named
+// "<target>.<verb>", e.g. "course.archive" or "user.suspend".
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+)
+
+type auditEvent struct {
+	Action     string
+	TargetType string
+	TargetID   interface{}
+	Before     interface{}
+	After      interface{}
+	// ActorID names the actor on routes without a principal, such as a
+	// password reset by emailed token.
+	ActorID int
+}
+
+func auditJSON(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// recordAudit appends e to audit. The actor, IP and request ID come from
+// r; background jobs pass a nil r and are recorded without an actor.
+func recordAudit(ctx context.Context, audit repository.AuditRepository, r *http.Request, e auditEvent) error {
+	entry := models.AuditEntry{Action: e.Action, TargetType: e.TargetType}
+	var err error
+	if entry.Before, err = auditJSON(e.Before); err != nil {
+		return fmt.Errorf("encoding audit before: %w", err)
+	}
+	if entry.After, err = auditJSON(e.After); err != nil {
+		return fmt.Errorf("encoding audit after: %w", err)
+	}
+
+	if r != nil {
+		if p, ok := middleware.PrincipalFrom(r.Context()); ok {
+			entry.ActorID, entry.ActorRole = &p.ID, p.Role
+		}
+		entry.IP, entry.RequestID = clientIP(r), middleware.RequestIDFrom(r.Context())
+	}
+	if entry.ActorID == nil && e.ActorID != 0 {
+		entry.ActorID = &e.ActorID
+	}
+	if e.TargetID != nil {
+		entry.TargetID = fmt.Sprint(e.TargetID)
+	}
+
+	return audit.Record(ctx, entry)
+}
+
+// auditFilter reads the filters of /api/admin/audit from its query string.
+// action accepts a trailing "*" to match a prefix, e.g. "user.*".
+func auditFilter(query map[string][]string) (repository.AuditFilter, error) {
+	get := func(key string) string {
+		if v := query[key]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+
+	f := repository.AuditFilter{
+		Action:     get("action"),
+		TargetType: get("targetType"),
+		TargetID:   get("targetId"),
+		RequestID:  get("requestId"),
+	}
+	if v := get("actorId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return f, errors.New("actorId must be an integer")
+		}
+		f.ActorID = &id
+	}
+	for _, bound := range []struct {
+		key string
+		t   *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := get(bound.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("%s must be an RFC 3339 timestamp", bound.key)
+		}
+		*bound.t = t.UTC()
+	}
+
+	return f, nil
+}
+
+// AuditHandler serves the audit log.
+type AuditHandler struct {
+	Audit repository.AuditRepository
+}
+
+// AuditLog serves GET /api/admin/audit. Filters: actorId, action, targetType,
+// targetId, requestId, from and to. JSON responses are paged like the user
+// list; format=csv (or Accept: text/csv) exports every matching entry.
+func (h *AuditHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := auditFilter(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, err.Error(), nil)
+		return
+	}
+
+	if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		h.exportAuditCSV(w, r, filter)
+		return
+	}
+
+	page, pageSize := 1, defaultAuditPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "page must be a positive integer", nil)
+			return
+		}
+		page = n
+	}
+	if v := query.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest,
+				fmt.Sprintf("pageSize must be between 1 and %d", maxAuditPageSize), nil)
+			return
+		}
+		pageSize = n
+	}
+
+	ctx := r.Context()
+	total, err := h.Audit.Count(ctx, filter)
+	if err != nil {
+		log.Printf("Error counting audit entries: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	entries, err := h.Audit.List(ctx, filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Printf("Error querying audit log: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Page, X-Page-Size")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Page", strconv.Itoa(page))
+	w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditExportPageSize is how many entries exportAuditCSV reads per query.
+const auditExportPageSize = 1000
+
+// csvCell defuses a value that a spreadsheet would otherwise run as a
+// formula by prefixing it with a quote.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// exportAuditCSV streams every entry matching filter, oldest first, reading
+// it one page at a time.
+func (h *AuditHandler) exportAuditCSV(w http.ResponseWriter, r *http.Request, filter repository.AuditFilter) {
+	// The first page is read before anything is sent so that a query that
+	// fails straight away can still be answered with an error.
+	entries, err := h.Audit.After(r.Context(), filter, 0, auditExportPageSize)
+	if err != nil {
+		log.Printf("Error querying audit log: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+	cw.Write([]string{"id", "occurred_at", "actor_id", "actor_role", "action", "target_type",
+		"target_id", "before", "after", "ip", "request_id"})
+
+	var lastID int64
+	for len(entries) > 0 {
+		for _, e := range entries {
+			actor := ""
+			if e.ActorID != nil {
+				actor = strconv.Itoa(*e.ActorID)
+			}
+			row := []string{strconv.FormatInt(e.ID, 10), e.OccurredAt, actor, e.ActorRole, e.Action,
+				e.TargetType, e.TargetID, string(e.Before), string(e.After), e.IP, e.RequestID}
+			for i := range row {
+				row[i] = csvCell(row[i])
+			}
+			cw.Write(row)
+			lastID = e.ID
+		}
+		if len(entries) < auditExportPageSize {
+			return
+		}
+
+		entries, err = h.Audit.After(r.Context(), filter, lastID, auditExportPageSize)
+		if err != nil {
+			// The status line is already sent, so end the file with a row
+			// that says it is incomplete instead of truncating it quietly.
+			log.Printf("Error reading audit log during export after entry %d: %v", lastID, err)
+			cw.Write([]string{"error", fmt.Sprintf("export incomplete: entries after %d could not be read", lastID)})
+			return
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+
+	"backend/models"
+	"backend/repository"
+)
+
+func TestExportAuditCSV(t *testing.T) {
+	s := repository.NewMemoryStore()
+	ctx := context.Background()
+	for _, targetID := range []string{"7", "=HYPERLINK(\"http://evil\")", "-2+3", "@SUM(A1)"} {
+		if err := s.Audit().Record(ctx, models.AuditEntry{Action: "user.rename", TargetType: "user", TargetID: targetID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/audit?format=csv", nil)
+	rec := httptest.NewRecorder()
+	(&AuditHandler{Audit: s.Audit()}).exportAuditCSV(rec, req, repository.AuditFilter{})
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows, want a header and 4 entries: %q", len(rows), rows)
+	}
+	want := []string{"7", "'=HYPERLINK(\"http://evil\")", "'-2+3", "'@SUM(A1)"}
+	for i, row := range rows[1:] {
+		if row[6] != want[i] {
+			t.Errorf("row %d target_id = %q, want %q", i+1, row[6], want[i])
+		}
+	}
+}
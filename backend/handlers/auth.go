@@ -1,27 +1,32 @@
 package handlers
 
 import (
-	"backend/config"
-	"backend/models"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+	"backend/utils"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte("3fa85f64-5717-4562-b3fc-2c963f66afa6")
+// AuthHandler serves registration, login, sessions, two-factor
+// authentication and the email verification and password reset flows.
+type AuthHandler struct {
+	Store repository.Store
+}
 
 type Credentials struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-func Register(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		return
 	}
@@ -40,7 +45,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, "Invalid request format")
 		return
 	}
-	
+	req.Email = normalizeEmail(req.Email)
 
 	if req.Username == "" || req.Email == "" || req.Password == "" {
 		log.Println("Registration error: Missing required fields")
@@ -49,9 +54,8 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 	
 
-	var exists bool
-	err = config.DB.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", req.Email).Scan(&exists)
+	users := h.Store.Users()
+	exists, err := users.EmailTaken(r.Context(), req.Email, 0)
 	if err != nil {
 		log.Printf("Register error checking email existence: %v", err)
 		writeJSONError(w, http.StatusInternalServerError, "Database error")
@@ -63,8 +67,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	err = config.DB.QueryRow(context.Background(),
-		"SELECT EXISTS(SELECT 1 FROM users WHERE username=$1)", req.Username).Scan(&exists)
+	exists, err = users.UsernameTaken(r.Context(), req.Username, 0)
 	if err != nil {
 		log.Printf("Register error checking username existence: %v", err)
 		writeJSONError(w, http.StatusInternalServerError, "Database error")
@@ -83,9 +86,12 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	_, err = config.DB.Exec(context.Background(),
-		"INSERT INTO users (username, email, password, role, progress, completed_courses) VALUES ($1, $2, $3, 'user', 0, 0)",
-		req.Username, req.Email, string(hashedPassword))
+	userID, err := users.Create(r.Context(), models.NewUser{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: string(hashedPassword),
+		Role:         middleware.RoleLearner,
+	})
 	if err != nil {
 		log.Printf("Error inserting new user: %v", err)
 		writeJSONError(w, http.StatusInternalServerError, "Gagal daftar")
@@ -94,74 +100,99 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	
 	log.Printf("Registration successful for user: %s (%s)", req.Username, req.Email)
 	
+	inBackground(r, "sending verification email", func(ctx context.Context) error {
+		return sendVerificationEmail(ctx, userID, req.Username, req.Email)
+	})
+	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Register sukses"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":              "Register sukses",
+		"verificationRequired": true,
+	})
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		return
 	}
 	var creds Credentials
 	json.NewDecoder(r.Body).Decode(&creds)
 
-	var user models.User
-	err := config.DB.QueryRow(context.Background(),
-		"SELECT id, password, role FROM users WHERE email=$1", creds.Email).Scan(&user.ID, &user.Password, &user.Role)
+	ip := clientIP(r)
+	blockedFor, err := loginBlockedFor(r.Context(), h.Store.Throttles(), creds.Email, ip)
 	if err != nil {
-		writeJSONError(w, http.StatusUnauthorized, "User tidak ditemukan")
+		log.Printf("Error checking login throttle: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
-		writeJSONError(w, http.StatusUnauthorized, "Password salah")
+	if blockedFor > 0 {
+		writeTooManyRequests(w, blockedFor, "Too many login attempts, please try again later")
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	})
-	tokenString, _ := token.SignedString(jwtKey)
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-		"role":  user.Role,
-	})
-}
+	// Unknown emails and wrong passwords get the same answer and cost the
+	// same time.
+	users := h.Store.Users()
+	user, err := users.FindByEmail(r.Context(), creds.Email)
+	var hashed string
+	if err == nil {
+		hashed, err = users.PasswordHash(r.Context(), user.ID)
+	}
+	switch {
+	case err == nil:
+		err = bcrypt.CompareHashAndPassword([]byte(hashed), []byte(creds.Password))
+	case errors.Is(err, repository.ErrNotFound):
+		burnPasswordCheck(creds.Password)
+	default:
+		log.Printf("Error loading user for login: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if err != nil {
+		if err := recordLoginFailure(r.Context(), h.Store.Throttles(), creds.Email, ip); err != nil {
+			log.Printf("Error recording login failure: %v", err)
+		}
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidCredentials, "Email atau password salah", nil)
+		return
+	}
 
-func AdminHandler(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == "OPTIONS" {
+	if user.SuspendedAt != nil {
+		writeAPIError(w, http.StatusForbidden, errCodeAccountSuspended, "This account has been suspended", nil)
 		return
 	}
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	if user.EmailVerifiedAt == nil {
+		writeAPIError(w, http.StatusForbidden, errCodeEmailNotVerified,
+			"Please verify your email address before logging in", nil)
 		return
 	}
-	tokenString := authHeader[len("Bearer "):]
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, nil
-		}
-		return jwtKey, nil
-	})
+	twoFactor, err := h.Store.TwoFactor().Enabled(r.Context(), user.ID)
 	if err != nil {
-		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		log.Printf("Error checking two-factor status for user %d: %v", user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if twoFactor {
+		// The failure counter is cleared only once the second factor
+		// passes, so codes cannot be guessed between password logins.
+		writeTwoFactorChallenge(w, user.ID)
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid || claims["role"] != "admin" {
-		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	if err := clearAccountThrottle(r.Context(), h.Store.Throttles(), creds.Email); err != nil {
+		log.Printf("Error clearing login throttle for user %d: %v", user.ID, err)
+	}
+
+	session, err := issueSession(r.Context(), h.Store.Sessions(), r, user.ID, user.Username, user.Role, "", false)
+	if err != nil {
+		log.Printf("Error issuing session for user %d: %v", user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Welcome, admin"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
 }
 
 func writeJSONError(w http.ResponseWriter, status int, message string) {
@@ -169,3 +200,15 @@ func writeJSONError(w http.ResponseWriter, status int, message string) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{"message": message})
 }
+
+// JWKS publishes the public keys used to sign tokens so other services can
+// verify them without sharing a secret.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.Tokens().JWKS())
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/repository"
+)
+
+func TestRegisterNormalizesEmail(t *testing.T) {
+	initTestTokens(t)
+	s := repository.NewMemoryStore()
+	h := &AuthHandler{Store: s}
+
+	register := func(username, email string) int {
+		req := httptest.NewRequest("POST", "/api/register",
+			strings.NewReader(`{"username":"`+username+`","email":"`+email+`","password":"correct horse"}`))
+		rec := httptest.NewRecorder()
+		h.Register(rec, req)
+		return rec.Code
+	}
+
+	if code := register("ada", "  Ada@Example.COM "); code != http.StatusCreated {
+		t.Fatalf("register: status = %d, want %d", code, http.StatusCreated)
+	}
+	WaitBackground(context.Background())
+
+	u, err := s.Users().FindByEmail(context.Background(), "ADA@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	if u.Email != "ada@example.com" {
+		t.Errorf("stored email = %q, want %q", u.Email, "ada@example.com")
+	}
+	if code := register("lovelace", "ada@EXAMPLE.com"); code != http.StatusBadRequest {
+		t.Errorf("register with a different case: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
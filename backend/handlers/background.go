@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// backgroundTimeout bounds work started after a response has been sent.
+const backgroundTimeout = time.Minute
+
+var background sync.WaitGroup
+
+// inBackground runs fn after the handler returns, so its duration, for
+// instance whether an email had to be sent, cannot be measured by the
+// client. fn keeps the request's values but not its cancellation.
+func inBackground(r *http.Request, what string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundTimeout)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("Error %s: %v", what, err)
+		}
+	}()
+}
+
+// WaitBackground blocks until work started by handlers in the background,
+// and the course purger once its context is cancelled, has finished or ctx
+// is done. main calls it on shutdown before closing the database pool.
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,41 +1,27 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 
-	"backend/config"
-	"backend/utils"
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
 )
 
-func ToggleBookmark(w http.ResponseWriter, r *http.Request) {
-    enableCORS(w)
-    if r.Method == "OPTIONS" {
-        return
-    }
-
-    authHeader := r.Header.Get("Authorization")
-    if !strings.HasPrefix(authHeader, "Bearer ") {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
+// BookmarkHandler serves a learner's bookmarks.
+type BookmarkHandler struct {
+    Bookmarks repository.BookmarkRepository
+}
 
-    token := strings.TrimPrefix(authHeader, "Bearer ")
-    claims, err := utils.VerifyToken(token)
-    if err != nil {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+func (h *BookmarkHandler) ToggleBookmark(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "OPTIONS" {
         return
     }
 
-    userIDFloat, ok := claims["user_id"].(float64)
-    if !ok {
-        http.Error(w, "Invalid user ID", http.StatusBadRequest)
-        return
-    }
-    userID := int(userIDFloat)
+    userID := middleware.MustPrincipal(r.Context()).ID
 
     var req struct {
         CourseID int `json:"courseId"`
@@ -45,10 +31,7 @@ func ToggleBookmark(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var exists bool
-    err = config.DB.QueryRow(context.Background(),
-        "SELECT EXISTS(SELECT 1 FROM user_bookmarks WHERE user_id = $1 AND course_id = $2)",
-        userID, req.CourseID).Scan(&exists)
+    exists, err := h.Bookmarks.Exists(r.Context(), userID, req.CourseID)
     if err != nil {
         log.Printf("Error checking bookmark existence: %v", err)
         http.Error(w, "Database error", http.StatusInternalServerError)
@@ -61,9 +44,7 @@ func ToggleBookmark(w http.ResponseWriter, r *http.Request) {
     }
 
     if exists {
-        _, err = config.DB.Exec(context.Background(),
-            "DELETE FROM user_bookmarks WHERE user_id = $1 AND course_id = $2",
-            userID, req.CourseID)
+        err = h.Bookmarks.Remove(r.Context(), userID, req.CourseID)
         if err != nil {
             log.Printf("Error removing bookmark: %v", err)
             http.Error(w, "Failed to remove bookmark", http.StatusInternalServerError)
@@ -72,9 +53,7 @@ func ToggleBookmark(w http.ResponseWriter, r *http.Request) {
         result.Message = "Bookmark removed"
         result.Bookmarked = false
     } else {
-        _, err = config.DB.Exec(context.Background(),
-            "INSERT INTO user_bookmarks (user_id, course_id) VALUES ($1, $2)",
-            userID, req.CourseID)
+        err = h.Bookmarks.Add(r.Context(), userID, req.CourseID)
         if err != nil {
             log.Printf("Error adding bookmark: %v", err)
             http.Error(w, "Failed to add bookmark", http.StatusInternalServerError)
@@ -88,78 +67,26 @@ func ToggleBookmark(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(result)
 }
 
-func GetBookmarks(w http.ResponseWriter, r *http.Request) {
-    enableCORS(w)
+func (h *BookmarkHandler) GetBookmarks(w http.ResponseWriter, r *http.Request) {
     if r.Method == "OPTIONS" {
         return
     }
     
-    log.Println("GetBookmarks handler called")
+    slog.Debug("GetBookmarks handler called")
     
-    authHeader := r.Header.Get("Authorization")
-    if !strings.HasPrefix(authHeader, "Bearer ") {
-        log.Println("Unauthorized: No Bearer token")
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
-
-    token := strings.TrimPrefix(authHeader, "Bearer ")
-    claims, err := utils.VerifyToken(token)
-    if err != nil {
-        log.Printf("Unauthorized: Invalid token: %v", err)
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
-        return
-    }
-
-    userIDFloat, ok := claims["user_id"].(float64)
-    if !ok {
-        log.Println("Invalid user ID in token claims")
-        http.Error(w, "Invalid user ID", http.StatusBadRequest)
-        return
-    }
-    userID := int(userIDFloat)
-
-    rows, err := config.DB.Query(context.Background(), `
-        SELECT c.id, c.title, c.description, c.level, c.duration, c.instructor, c.video_url,
-        CASE WHEN uc.user_id IS NOT NULL THEN true ELSE false END as enrolled,
-        CASE WHEN uc.completed IS TRUE THEN true ELSE false END as completed
-        FROM courses c
-        JOIN user_bookmarks b ON c.id = b.course_id
-        LEFT JOIN user_courses uc ON c.id = uc.course_id AND uc.user_id = $1
-        WHERE b.user_id = $1
-        ORDER BY b.created_at DESC
-    `, userID)
+    userID := middleware.MustPrincipal(r.Context()).ID
 
+    bookmarks, err := h.Bookmarks.Courses(r.Context(), userID)
     if err != nil {
         log.Printf("Error querying bookmarks: %v", err)
         http.Error(w, "Failed to fetch bookmarks", http.StatusInternalServerError)
         return
     }
-    defer rows.Close()
-
-    var bookmarks []map[string]interface{}
-    for rows.Next() {
-        var id int
-        var title, description, level, duration, instructor, videoUrl string
-        var enrolled, completed bool
-        
-        err := rows.Scan(&id, &title, &description, &level, &duration, &instructor, &videoUrl, &enrolled, &completed)
-        if err != nil {
-            log.Printf("Error scanning bookmark row: %v", err)
-            continue
-        }
-        
-        bookmarks = append(bookmarks, map[string]interface{}{
-            "id":          id,
-            "title":       title,
-            "description": description,
-            "level":       level,
-            "duration":    duration,
-            "instructor":  instructor,
-            "videoUrl":    videoUrl,
-            "enrolled":    enrolled,
-            "completed":   completed,
-        })
+    if bookmarks == nil {
+        bookmarks = []models.BookmarkedCourse{}
+    }
+    for i := range bookmarks {
+        bookmarks[i].Progress = percent(bookmarks[i].CompletedModules, bookmarks[i].TotalModules)
     }
 
     log.Printf("Found %d bookmarks for user ID: %d", len(bookmarks), userID)
@@ -167,5 +94,3 @@ func GetBookmarks(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(bookmarks)
 }
-
-
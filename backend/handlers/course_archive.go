@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/middleware"
+	"backend/repository"
+)
+
+// Deleting a course only archives it: archived courses disappear from the
+// catalogue, search, recommendations and progress, but their modules and
+// learner history stay in place so the course can be restored. The purge
+// job removes them for good once they have been archived longer than
+// courseRetention.
+
+const purgeCoursesJob = "purge-archived-courses"
+
+// courseRetention is how long an archived course can be restored. It is
+// set by StartCoursePurger.
+var courseRetention time.Duration
+
+// writeCourseArchived rejects a change to a course that is waiting to be
+// purged; it has to be restored first.
+func writeCourseArchived(w http.ResponseWriter, courseID int) {
+	writeAPIError(w, http.StatusConflict, errCodeCourseArchived, "Course is archived; restore it to make changes",
+		map[string]interface{}{"courseId": courseID})
+}
+
+// archiveCourse handles DELETE /api/admin/courses/{id}.
+func (h *CourseHandler) archiveCourse(w http.ResponseWriter, r *http.Request, courseID int) {
+	ctx := r.Context()
+	var archivedAt, purgeAfter time.Time
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		course, err := store.Courses().Lock(ctx, courseID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+				map[string]interface{}{"courseId": courseID})
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading course %d: %w", courseID, err)
+		}
+		if course.ArchivedAt != nil {
+			writeAPIError(w, http.StatusConflict, errCodeCourseArchived, "Course is already archived",
+				map[string]interface{}{"courseId": courseID})
+			return errResponseWritten
+		}
+
+		before, err := courseSnapshot(ctx, store, courseID)
+		if err != nil {
+			return fmt.Errorf("loading course %d: %w", courseID, err)
+		}
+		archivedAt, err = store.Courses().Archive(ctx, courseID, middleware.MustPrincipal(ctx).ID)
+		if err != nil {
+			return fmt.Errorf("archiving course %d: %w", courseID, err)
+		}
+
+		purgeAfter = archivedAt.Add(courseRetention)
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "course.archive", TargetType: "course", TargetID: courseID, Before: before,
+			After: map[string]string{
+				"archivedAt": formatTimestamp(&archivedAt),
+				"purgeAfter": formatTimestamp(&purgeAfter),
+			},
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error archiving course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to archive course")
+		return
+	}
+
+	log.Printf("Course %d archived; purge after %s", courseID, purgeAfter.Format(time.RFC3339))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Course archived. It can be restored until it is purged.",
+		"courseId":   courseID,
+		"archivedAt": formatTimestamp(&archivedAt),
+		"purgeAfter": formatTimestamp(&purgeAfter),
+	})
+}
+
+// restoreCourse handles POST /api/admin/courses/{id}/restore.
+func (h *CourseHandler) restoreCourse(w http.ResponseWriter, r *http.Request, courseID int) {
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		course, err := store.Courses().Lock(ctx, courseID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+				map[string]interface{}{"courseId": courseID})
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading course %d: %w", courseID, err)
+		}
+		if course.ArchivedAt == nil {
+			writeAPIError(w, http.StatusConflict, errCodeCourseNotArchived, "Course is not archived",
+				map[string]interface{}{"courseId": courseID})
+			return errResponseWritten
+		}
+
+		before, err := courseSnapshot(ctx, store, courseID)
+		if err != nil {
+			return fmt.Errorf("loading course %d: %w", courseID, err)
+		}
+		if err := store.Courses().Restore(ctx, courseID); err != nil {
+			return fmt.Errorf("restoring course %d: %w", courseID, err)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "course.restore", TargetType: "course", TargetID: courseID, Before: before,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to restore course")
+		return
+	}
+
+	log.Printf("Course %d restored", courseID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Course restored",
+		"courseId": courseID,
+	})
+}
+
+// listArchivedCourses handles GET /api/admin/courses?archived=true. Callers
+// without course:write:any only see the courses they own.
+func (h *CourseHandler) listArchivedCourses(w http.ResponseWriter, r *http.Request) {
+	p := middleware.MustPrincipal(r.Context())
+	ownerFilter := p.ID
+	if p.Can(middleware.PermCourseWriteAny) {
+		ownerFilter = 0
+	}
+
+	archived, err := h.Store.Courses().Archived(r.Context(), ownerFilter)
+	if err != nil {
+		log.Printf("Error querying archived courses: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch courses")
+		return
+	}
+
+	courses := []map[string]interface{}{}
+	for _, c := range archived {
+		purgeAfter := c.ArchivedAt.Add(courseRetention)
+		courses = append(courses, map[string]interface{}{
+			"id":         c.ID,
+			"title":      c.Title,
+			"level":      c.Level,
+			"ownerId":    c.OwnerID,
+			"archivedAt": formatTimestamp(c.ArchivedAt),
+			"archivedBy": c.ArchivedBy,
+			"purgeAfter": formatTimestamp(&purgeAfter),
+		})
+	}
+
+	json.NewEncoder(w).Encode(courses)
+}
+
+type purgeSummary struct {
+	CourseIDs []int `json:"courseIds"`
+}
+
+// purgeArchivedCourses deletes every course archived longer than
+// courseRetention together with its modules and learner history. Each
+// course gets its own audit entry.
+func purgeArchivedCourses(ctx context.Context, store repository.Store) (purgeSummary, error) {
+	summary := purgeSummary{CourseIDs: []int{}}
+
+	err := store.WithTx(ctx, func(store repository.Store) error {
+		if err := store.Maintenance().LockJob(ctx, purgeCoursesJob); err != nil {
+			return err
+		}
+
+		due, err := store.Courses().ArchivedBefore(ctx, time.Now().Add(-courseRetention))
+		if err != nil {
+			return err
+		}
+		for _, courseID := range due {
+			before, err := courseSnapshot(ctx, store, courseID)
+			if err != nil {
+				return err
+			}
+			if err := store.Courses().Purge(ctx, courseID); err != nil {
+				return err
+			}
+			err = recordAudit(ctx, store.Audit(), nil, auditEvent{
+				Action: "course.purge", TargetType: "course", TargetID: courseID, Before: before,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		summary.CourseIDs = append(summary.CourseIDs, due...)
+		return nil
+	})
+	return summary, err
+}
+
+// runCoursePurge performs one purge pass. Passes that find nothing to purge
+// are not recorded as maintenance runs so the run history stays readable.
+func runCoursePurge(ctx context.Context, store repository.Store) {
+	due, err := store.Courses().ArchivedBefore(ctx, time.Now().Add(-courseRetention))
+	if err != nil {
+		log.Printf("Error checking for courses to purge: %v", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	runs := store.Maintenance()
+	runID, err := runs.Start(ctx, purgeCoursesJob, 0, false)
+	if err != nil {
+		log.Printf("Error recording maintenance run: %v", err)
+		return
+	}
+
+	summary, runErr := purgeArchivedCourses(ctx, store)
+	if _, err := finishMaintenanceRun(context.WithoutCancel(ctx), runs, runID, summary, runErr); err != nil {
+		log.Printf("Error finishing maintenance run %d: %v", runID, err)
+	}
+	if runErr != nil {
+		log.Printf("Course purge run %d failed: %v", runID, runErr)
+		return
+	}
+	log.Printf("Course purge run %d removed %d archived courses: %v", runID, len(summary.CourseIDs), summary.CourseIDs)
+}
+
+// StartCoursePurger sets how long archived courses are kept and purges the
+// expired ones now and then every interval until ctx is cancelled.
+// WaitBackground waits for it to stop.
+func StartCoursePurger(ctx context.Context, store repository.Store, retention, interval time.Duration) {
+	courseRetention = retention
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runCoursePurge(ctx, store)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/middleware"
+	"backend/repository"
+)
+
+func adminCourseRequest(h *CourseHandler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), &middleware.Principal{ID: 1, Role: middleware.RoleAdmin}))
+	rec := httptest.NewRecorder()
+	h.AdminCourseByID(rec, req)
+	return rec
+}
+
+func TestArchiveAndRestoreCourse(t *testing.T) {
+	s := repository.NewMemoryStore()
+	courseID := s.AddCourse("React Native Basics")
+	h := &CourseHandler{Store: s}
+	path := fmt.Sprintf("/api/admin/courses/%d", courseID)
+	ctx := context.Background()
+
+	steps := []struct {
+		method, path string
+		wantStatus   int
+		wantLive     bool
+	}{
+		{"DELETE", path, http.StatusOK, false},
+		{"DELETE", path, http.StatusConflict, false},
+		{"POST", path + "/restore", http.StatusOK, true},
+		{"POST", path + "/restore", http.StatusConflict, true},
+	}
+	for _, step := range steps {
+		rec := adminCourseRequest(h, step.method, step.path, "")
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s %s: status = %d, want %d; body %s", step.method, step.path, rec.Code, step.wantStatus, rec.Body)
+		}
+		if live, _ := s.Courses().Exists(ctx, courseID); live != step.wantLive {
+			t.Errorf("%s %s: course live = %v, want %v", step.method, step.path, live, step.wantLive)
+		}
+	}
+
+	entries, err := s.Audit().List(ctx, repository.AuditFilter{TargetType: "course"}, 0, 10)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("audit entries = %v, %v; want an archive and a restore", entries, err)
+	}
+}
+
+func TestPurgeArchivedCourses(t *testing.T) {
+	s := repository.NewMemoryStore()
+	userID := s.AddUser(true)
+	expired, recent, live := s.AddCourse("Expired"), s.AddCourse("Recent"), s.AddCourse("Live")
+	module := s.AddModule(expired)
+	ctx := context.Background()
+	if err := s.Modules().Complete(ctx, userID, expired, module); err != nil {
+		t.Fatal(err)
+	}
+
+	courseRetention = time.Hour
+	s.Now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	s.ArchiveCourse(expired)
+	s.Now = time.Now
+	s.ArchiveCourse(recent)
+
+	summary, err := purgeArchivedCourses(ctx, s)
+	if err != nil {
+		t.Fatalf("purgeArchivedCourses: %v", err)
+	}
+	if len(summary.CourseIDs) != 1 || summary.CourseIDs[0] != expired {
+		t.Errorf("purged %v, want [%d]", summary.CourseIDs, expired)
+	}
+	for _, id := range []int{recent, live} {
+		if _, err := s.Courses().Find(ctx, id); err != nil {
+			t.Errorf("course %d: %v", id, err)
+		}
+	}
+	if _, err := s.Courses().Find(ctx, expired); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expired course: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Modules().CourseID(ctx, module); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("module of the expired course: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+)
+
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// loadEnrollment returns the user's enrollment in a course, or
+// repository.ErrNotFound. Progress is derived from completed modules rather
+// than the stored column.
+func loadEnrollment(ctx context.Context, store repository.Store, userID, courseID int) (models.UserCourse, error) {
+	e, err := store.Enrollments().Get(ctx, userID, courseID)
+	if err != nil {
+		return e, err
+	}
+	completed, total, err := store.Modules().Progress(ctx, userID, courseID)
+	if err != nil {
+		return e, err
+	}
+	e.Progress = percent(completed, total)
+	return e, nil
+}
+
+// handleEnrollment serves /api/courses/{id}/enrollment:
+//
+//	GET    current enrollment
+//	POST   enroll, or resume a paused or dropped enrollment
+//	PATCH  {"status": "paused"|"active"} to pause or resume
+//	DELETE drop the course; completed modules are kept
+func handleEnrollment(w http.ResponseWriter, r *http.Request, store repository.Store, courseID int) {
+	userID := middleware.MustPrincipal(r.Context()).ID
+
+	courseExists, err := store.Courses().Exists(r.Context(), courseID)
+	if err != nil {
+		log.Printf("Error checking if course exists: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !courseExists {
+		writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+			map[string]interface{}{"courseId": courseID})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		e, err := loadEnrollment(r.Context(), store, userID, courseID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, errCodeNotEnrolled, "Not enrolled in this course", nil)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading enrollment: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	case "POST":
+		if !requireVerifiedUser(r.Context(), w, store.Users(), userID) {
+			return
+		}
+		changeEnrollment(w, r, store, userID, courseID, models.EnrollmentActive)
+	case "PATCH", "PUT":
+		var req struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+			return
+		}
+		if req.Status != models.EnrollmentActive && req.Status != models.EnrollmentPaused {
+			writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation,
+				"status must be \"active\" or \"paused\"", nil)
+			return
+		}
+		changeEnrollment(w, r, store, userID, courseID, req.Status)
+	case "DELETE":
+		changeEnrollment(w, r, store, userID, courseID, models.EnrollmentDropped)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// changeEnrollment moves an enrollment to the target state. Enrolling
+// (target active) creates the enrollment when needed; pausing and dropping
+// require an existing one.
+func changeEnrollment(w http.ResponseWriter, r *http.Request, store repository.Store, userID, courseID int, target string) {
+	ctx := r.Context()
+	var from string
+	var e models.UserCourse
+	err := store.WithTx(ctx, func(store repository.Store) error {
+		var err error
+		from, err = store.Enrollments().Transition(ctx, userID, courseID, target)
+		if err != nil {
+			return err
+		}
+		e, err = loadEnrollment(ctx, store, userID, courseID)
+		return err
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, errCodeNotEnrolled, "Not enrolled in this course", nil)
+		return
+	case errors.Is(err, repository.ErrBadTransition):
+		writeAPIError(w, http.StatusConflict, errCodeBadTransition,
+			"Only active enrollments can be paused",
+			map[string]interface{}{"from": from, "to": target})
+		return
+	case err != nil:
+		log.Printf("Error updating enrollment: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	status := http.StatusOK
+	if from == "" {
+		status = http.StatusCreated
+		log.Printf("User %d enrolled in course %d", userID, courseID)
+	} else if from != e.Status {
+		log.Printf("Enrollment of user %d in course %d: %s -> %s", userID, courseID, from, e.Status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
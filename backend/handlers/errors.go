@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of typed API errors. Clients
+// should branch on the code; the message is for humans and may change.
+const (
+	errCodeInvalidRequest     = "invalid_request"
+	errCodeValidation         = "validation_failed"
+	errCodeCourseNotFound     = "course_not_found"
+	errCodeModuleNotFound     = "module_not_found"
+	errCodeModuleMismatch     = "module_not_in_course"
+	errCodeNotEnrolled        = "not_enrolled"
+	errCodeBadTransition      = "invalid_transition"
+	errCodeInvalidRefresh     = "invalid_refresh_token"
+	errCodeRefreshExpired     = "refresh_token_expired"
+	errCodeRefreshReused      = "refresh_token_reused"
+	errCodeForbidden          = "forbidden"
+	errCodeNotCourseOwner     = "not_course_owner"
+	errCodeJobRunning         = "job_running"
+	errCodeJobFailed          = "job_failed"
+	errCodeRunNotFound        = "run_not_found"
+	errCodeInvalidReset       = "invalid_reset_token"
+	errCodeResetExpired       = "reset_token_expired"
+	errCodeEmailNotVerified   = "email_not_verified"
+	errCodeInvalidVerify      = "invalid_verification_token"
+	errCodeVerifyExpired      = "verification_token_expired"
+	errCodeInvalidCredentials = "invalid_credentials"
+	errCodeTooManyAttempts    = "too_many_attempts"
+	errCodeUserNotFound       = "user_not_found"
+	errCodeInvalidChallenge   = "invalid_two_factor_challenge"
+	errCodeInvalidTwoFactor   = "invalid_two_factor_code"
+	errCodeTwoFactorEnabled   = "two_factor_already_enabled"
+	errCodeTwoFactorNotSetUp  = "two_factor_not_set_up"
+	errCodeTwoFactorRequired  = "two_factor_required"
+	errCodeInvalidPassword    = "invalid_password"
+	errCodeUsernameTaken      = "username_taken"
+	errCodeEmailTaken         = "email_taken"
+	errCodeAccountSuspended   = "account_suspended"
+	errCodeInvalidRole        = "invalid_role"
+	errCodeSelfModification   = "self_modification"
+	errCodeCourseArchived     = "course_archived"
+	errCodeCourseNotArchived  = "course_not_archived"
+)
+
+// errResponseWritten is returned from a transaction callback that has
+// already written an error response, so the caller only has to roll back.
+var errResponseWritten = errors.New("response already written")
+
+type apiError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// writeAPIError writes a typed error. It keeps the "message" key used by
+// writeJSONError so existing clients continue to show the text.
+func writeAPIError(w http.ResponseWriter, status int, code, message string, details map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Code: code, Message: message, Details: details})
+}
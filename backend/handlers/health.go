@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"backend/migrate"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// readinessTimeout bounds the checks behind /readyz so a stuck database
+// fails the probe instead of hanging it.
+const readinessTimeout = 2 * time.Second
+
+// shuttingDown is set once the server has been told to stop, so load
+// balancers stop sending traffic while in-flight requests drain.
+var shuttingDown atomic.Bool
+
+// ShuttingDown makes /readyz fail from now on.
+func ShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// HealthHandler serves the liveness and readiness probes. Readiness talks
+// to the pool directly since migrations are not behind the Store.
+type HealthHandler struct {
+	Pool *pgxpool.Pool
+}
+
+// Healthz reports that the process is up and serving. It deliberately
+// checks nothing else, so a database outage does not get the process
+// restarted.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeAPIError(w, http.StatusMethodNotAllowed, errCodeInvalidRequest, "Method not allowed", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether the server can take traffic: it is not shutting
+// down, the database answers and every migration has been applied. A
+// failing check returns 503 with the reason for each check.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeAPIError(w, http.StatusMethodNotAllowed, errCodeInvalidRequest, "Method not allowed", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if shuttingDown.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]string{"database": "ok", "migrations": "ok"}
+	ready := true
+	if err := h.Pool.Ping(ctx); err != nil {
+		log.Printf("Readiness check: database ping failed: %v", err)
+		checks["database"] = "unreachable"
+		checks["migrations"] = "unknown"
+		ready = false
+	} else if pending, err := migrate.Pending(ctx, h.Pool); err != nil {
+		log.Printf("Readiness check: could not list pending migrations: %v", err)
+		checks["migrations"] = "unknown"
+		ready = false
+	} else if len(pending) > 0 {
+		checks["migrations"] = fmt.Sprintf("%d pending", len(pending))
+		ready = false
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "checks": checks})
+}
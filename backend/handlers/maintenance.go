@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+)
+
+const cleanupModulesJob = "cleanup-modules"
+
+type cleanupSummary struct {
+	CoursesAffected     int                      `json:"coursesAffected"`
+	ModulesRemoved      int                      `json:"modulesRemoved"`
+	CompletionsRemapped int                      `json:"completionsRemapped"`
+	Duplicates          []models.DuplicateModule `json:"duplicates"`
+}
+
+// MaintenanceHandler runs the maintenance jobs and serves their history.
+type MaintenanceHandler struct {
+	Store repository.Store
+}
+
+// cleanupDuplicateModules removes duplicate modules and moves their
+// completions onto the survivor so no learner loses progress. With dryRun
+// the same work is computed but nothing is written. start records the run
+// once the job lock is held, so a run turned away with ErrJobRunning leaves
+// no history behind. A real run is recorded in the audit log under the run
+// ID even when there was nothing to remove.
+func cleanupDuplicateModules(ctx context.Context, store repository.Store, r *http.Request, dryRun bool, start func() (int64, error)) (cleanupSummary, error) {
+	summary := cleanupSummary{Duplicates: []models.DuplicateModule{}}
+
+	err := store.WithTx(ctx, func(store repository.Store) error {
+		if err := store.Maintenance().LockJob(ctx, cleanupModulesJob); err != nil {
+			return err
+		}
+		runID, err := start()
+		if err != nil {
+			return fmt.Errorf("recording maintenance run: %w", err)
+		}
+
+		dups, err := store.Modules().Duplicates(ctx)
+		if err != nil {
+			return err
+		}
+
+		courses := map[int]bool{}
+		for _, d := range dups {
+			courses[d.CourseID] = true
+			summary.CompletionsRemapped += d.Completions
+		}
+		summary.Duplicates = dups
+		summary.CoursesAffected = len(courses)
+		summary.ModulesRemoved = len(dups)
+
+		if dryRun {
+			return nil
+		}
+		if len(dups) > 0 {
+			if err := store.Modules().Merge(ctx, dups); err != nil {
+				return err
+			}
+			for courseID := range courses {
+				if err := store.Modules().Renumber(ctx, courseID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "maintenance.cleanup_modules", TargetType: "maintenance_run", TargetID: runID, After: summary,
+		})
+	})
+	return summary, err
+}
+
+// finishMaintenanceRun records how a run ended and returns its status.
+func finishMaintenanceRun(ctx context.Context, runs repository.MaintenanceRepository, runID int64, summary interface{}, runErr error) (string, error) {
+	status, errText := models.RunSucceeded, ""
+	if runErr != nil {
+		status, errText = models.RunFailed, runErr.Error()
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return status, err
+	}
+	return status, runs.Finish(ctx, runID, status, summaryJSON, errText)
+}
+
+// CleanupDuplicateModules runs the duplicate module cleanup as a recorded
+// maintenance job. POST ?dryRun=true reports what would be removed without
+// changing anything.
+func (h *MaintenanceHandler) CleanupDuplicateModules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "dryRun must be a boolean", nil)
+			return
+		}
+		dryRun = parsed
+	}
+
+	ctx := r.Context()
+	actorID := middleware.MustPrincipal(r.Context()).ID
+
+	// The run is recorded outside the cleanup transaction so that it
+	// survives a rollback.
+	var runID int64
+	summary, runErr := cleanupDuplicateModules(ctx, h.Store, r, dryRun, func() (int64, error) {
+		var err error
+		runID, err = h.Store.Maintenance().Start(ctx, cleanupModulesJob, actorID, dryRun)
+		return runID, err
+	})
+	if errors.Is(runErr, repository.ErrJobRunning) {
+		writeAPIError(w, http.StatusConflict, errCodeJobRunning, "A cleanup run is already in progress", nil)
+		return
+	}
+	if runID == 0 {
+		log.Printf("Error starting cleanup run: %v", runErr)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	// Record the outcome even when the client has gone away and cancelled ctx.
+	status, err := finishMaintenanceRun(context.WithoutCancel(ctx), h.Store.Maintenance(), runID, summary, runErr)
+	if err != nil {
+		log.Printf("Error finishing maintenance run %d: %v", runID, err)
+	}
+
+	if runErr != nil {
+		log.Printf("Cleanup run %d failed: %v", runID, runErr)
+		writeAPIError(w, http.StatusInternalServerError, errCodeJobFailed, "Cleanup failed; no changes were made",
+			map[string]interface{}{"runId": runID})
+		return
+	}
+
+	log.Printf("Cleanup run %d by user %d (dryRun=%v): %d duplicate modules in %d courses, %d completions remapped",
+		runID, actorID, dryRun, summary.ModulesRemoved, summary.CoursesAffected, summary.CompletionsRemapped)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runId":   runID,
+		"job":     cleanupModulesJob,
+		"dryRun":  dryRun,
+		"status":  status,
+		"summary": summary,
+	})
+}
+
+// MaintenanceRuns serves the maintenance job history:
+//
+//	GET /api/admin/maintenance/runs?job=&status=&limit=  newest first, without summaries
+//	GET /api/admin/maintenance/runs/{id}                 a single run with its summary
+func (h *MaintenanceHandler) MaintenanceRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/maintenance/runs"), "/")
+	if idStr != "" {
+		runID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid run ID", nil)
+			return
+		}
+		h.getMaintenanceRun(w, r, runID)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "limit must be between 1 and 200", nil)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.Store.Maintenance().List(r.Context(), query.Get("job"), query.Get("status"), limit)
+	if err != nil {
+		log.Printf("Error querying maintenance runs: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch maintenance runs")
+		return
+	}
+
+	json.NewEncoder(w).Encode(runs)
+}
+
+func (h *MaintenanceHandler) getMaintenanceRun(w http.ResponseWriter, r *http.Request, runID int64) {
+	run, err := h.Store.Maintenance().Get(r.Context(), runID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, errCodeRunNotFound, "Maintenance run not found",
+			map[string]interface{}{"runId": runID})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading maintenance run %d: %v", runID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/models"
+	"backend/repository"
+)
+
+// handleCourseModules serves /api/admin/courses/{id}/modules and its
+// sub-paths. rest holds the path segments after "modules".
+func (h *CourseHandler) handleCourseModules(w http.ResponseWriter, r *http.Request, courseID int, rest []string) {
+	course, err := h.Store.Courses().Find(r.Context(), courseID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking if course exists: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if course.ArchivedAt != nil && r.Method != "GET" {
+		writeCourseArchived(w, courseID)
+		return
+	}
+
+	if len(rest) == 0 || rest[0] == "" {
+		switch r.Method {
+		case "GET":
+			h.listModules(w, r, courseID)
+		case "POST":
+			h.createModule(w, r, courseID)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	if rest[0] == "reorder" {
+		if r.Method != "PUT" && r.Method != "POST" {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.reorderModules(w, r, courseID)
+		return
+	}
+
+	moduleID, err := strconv.Atoi(rest[0])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid module ID")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		h.getModule(w, r, courseID, moduleID)
+	case "PUT":
+		h.updateModule(w, r, courseID, moduleID)
+	case "DELETE":
+		h.deleteModule(w, r, courseID, moduleID)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *CourseHandler) listModules(w http.ResponseWriter, r *http.Request, courseID int) {
+	modules, err := h.Store.Modules().ForCourse(r.Context(), courseID)
+	if err != nil {
+		log.Printf("Error querying modules for course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch modules")
+		return
+	}
+
+	json.NewEncoder(w).Encode(modules)
+}
+
+func (h *CourseHandler) getModule(w http.ResponseWriter, r *http.Request, courseID, moduleID int) {
+	m, err := h.Store.Modules().Get(r.Context(), courseID, moduleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Module not found")
+			return
+		}
+		log.Printf("Error fetching module %d: %v", moduleID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch module")
+		return
+	}
+
+	json.NewEncoder(w).Encode(m)
+}
+
+// findModule returns the module with the given ID from modules.
+func findModule(modules []models.CourseModule, moduleID int) (models.CourseModule, bool) {
+	for _, m := range modules {
+		if m.ID == moduleID {
+			return m, true
+		}
+	}
+	return models.CourseModule{}, false
+}
+
+func (h *CourseHandler) createModule(w http.ResponseWriter, r *http.Request, courseID int) {
+	var req courseModuleInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		writeJSONError(w, http.StatusBadRequest, "Module title is required")
+		return
+	}
+
+	ctx := r.Context()
+	var m models.CourseModule
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		if err := store.Modules().Renumber(ctx, courseID); err != nil {
+			return fmt.Errorf("renumbering modules: %w", err)
+		}
+		modules, err := store.Modules().Lock(ctx, courseID)
+		if err != nil {
+			return fmt.Errorf("loading modules: %w", err)
+		}
+
+		// Without an explicit position the module is appended; otherwise the
+		// modules at and after that position move down by one.
+		order := req.Order
+		if order <= 0 || order > len(modules)+1 {
+			order = len(modules) + 1
+		}
+		for _, existing := range modules {
+			if existing.Order < order {
+				continue
+			}
+			existing.Order++
+			if err := store.Modules().Update(ctx, existing); err != nil {
+				return fmt.Errorf("shifting module %d: %w", existing.ID, err)
+			}
+		}
+
+		moduleID, err := store.Modules().Create(ctx, models.CourseModule{
+			CourseID: courseID, Title: req.Title, Description: req.Description,
+			Content: req.Content, VideoUrl: req.VideoUrl, Order: order,
+		})
+		if err != nil {
+			return fmt.Errorf("inserting module: %w", err)
+		}
+		if m, err = store.Modules().Get(ctx, courseID, moduleID); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "module.create", TargetType: "module", TargetID: m.ID, After: m,
+		})
+	})
+	if err != nil {
+		log.Printf("Error creating module for course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create module")
+		return
+	}
+
+	log.Printf("Module %d created for course %d", m.ID, courseID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+func (h *CourseHandler) updateModule(w http.ResponseWriter, r *http.Request, courseID, moduleID int) {
+	var req struct {
+		Title         *string `json:"title"`
+		Description   *string `json:"description"`
+		Content       *string `json:"content"`
+		VideoUrl      *string `json:"videoUrl"`
+		AutoGenerated *bool   `json:"autoGenerated"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		writeJSONError(w, http.StatusBadRequest, "Module title cannot be empty")
+		return
+	}
+
+	ctx := r.Context()
+	var m models.CourseModule
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		modules, err := store.Modules().Lock(ctx, courseID)
+		if err != nil {
+			return fmt.Errorf("loading modules: %w", err)
+		}
+		before, ok := findModule(modules, moduleID)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Module not found")
+			return errResponseWritten
+		}
+
+		m = before
+		if req.Title != nil {
+			m.Title = *req.Title
+		}
+		if req.Description != nil {
+			m.Description = *req.Description
+		}
+		if req.Content != nil {
+			m.Content = *req.Content
+		}
+		if req.VideoUrl != nil {
+			m.VideoUrl = *req.VideoUrl
+		}
+		if err := store.Modules().Update(ctx, m); err != nil {
+			return err
+		}
+		if req.AutoGenerated != nil && *req.AutoGenerated != before.AutoGenerated {
+			if err := store.Modules().SetAutoGenerated(ctx, moduleID, *req.AutoGenerated); err != nil {
+				return err
+			}
+			m.AutoGenerated = *req.AutoGenerated
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "module.update", TargetType: "module", TargetID: moduleID, Before: before, After: m,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating module %d: %v", moduleID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update module")
+		return
+	}
+
+	log.Printf("Module %d of course %d updated", moduleID, courseID)
+
+	json.NewEncoder(w).Encode(m)
+}
+
+func (h *CourseHandler) deleteModule(w http.ResponseWriter, r *http.Request, courseID, moduleID int) {
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		modules, err := store.Modules().Lock(ctx, courseID)
+		if err != nil {
+			return fmt.Errorf("loading modules: %w", err)
+		}
+		before, ok := findModule(modules, moduleID)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Module not found")
+			return errResponseWritten
+		}
+
+		if _, err := store.Modules().Delete(ctx, courseID, []int{moduleID}); err != nil {
+			return err
+		}
+		if err := store.Modules().Renumber(ctx, courseID); err != nil {
+			return fmt.Errorf("renumbering modules: %w", err)
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "module.delete", TargetType: "module", TargetID: moduleID, Before: before,
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting module %d: %v", moduleID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete module")
+		return
+	}
+
+	log.Printf("Module %d of course %d deleted", moduleID, courseID)
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Module deleted successfully"})
+}
+
+// reorderModules rewrites the order of every module of a course in one
+// transaction. The request must list each module ID of the course exactly once.
+func (h *CourseHandler) reorderModules(w http.ResponseWriter, r *http.Request, courseID int) {
+	var req struct {
+		ModuleIDs []int `json:"moduleIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		modules, err := store.Modules().Lock(ctx, courseID)
+		if err != nil {
+			return fmt.Errorf("loading modules: %w", err)
+		}
+		existing := map[int]*models.CourseModule{}
+		listed := map[int]bool{}
+		previousOrder := []int{}
+		for i := range modules {
+			existing[modules[i].ID] = &modules[i]
+			previousOrder = append(previousOrder, modules[i].ID)
+		}
+
+		if len(req.ModuleIDs) != len(existing) {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("moduleIds must list all %d modules of the course", len(existing)))
+			return errResponseWritten
+		}
+		for _, id := range req.ModuleIDs {
+			if existing[id] == nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Module %d does not belong to course %d", id, courseID))
+				return errResponseWritten
+			}
+			if listed[id] {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Module %d is listed more than once", id))
+				return errResponseWritten
+			}
+			listed[id] = true
+		}
+
+		for i, id := range req.ModuleIDs {
+			m := existing[id]
+			if m.Order == i+1 {
+				continue
+			}
+			m.Order = i + 1
+			if err := store.Modules().Update(ctx, *m); err != nil {
+				return fmt.Errorf("moving module %d: %w", id, err)
+			}
+		}
+
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "course.reorder_modules", TargetType: "course", TargetID: courseID,
+			Before: map[string]interface{}{"moduleIds": previousOrder},
+			After:  map[string]interface{}{"moduleIds": req.ModuleIDs},
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error reordering modules for course %d: %v", courseID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to reorder modules")
+		return
+	}
+
+	log.Printf("Reordered %d modules for course %d", len(req.ModuleIDs), courseID)
+
+	h.listModules(w, r, courseID)
+}
+
+// ListAutoGeneratedModules reports modules flagged as placeholder content so
+// they can be reviewed and removed through the module endpoints.
+func (h *CourseHandler) ListAutoGeneratedModules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	modules, err := h.Store.Modules().AutoGenerated(r.Context())
+	if err != nil {
+		log.Printf("Error querying auto-generated modules: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch modules")
+		return
+	}
+
+	json.NewEncoder(w).Encode(modules)
+}
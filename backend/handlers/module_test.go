@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"backend/models"
+	"backend/repository"
+)
+
+func TestCourseModules(t *testing.T) {
+	s := repository.NewMemoryStore()
+	courseID := s.AddCourse("React Native Basics")
+	first, second := s.AddModule(courseID), s.AddModule(courseID)
+	h := &CourseHandler{Store: s}
+	path := fmt.Sprintf("/api/admin/courses/%d/modules", courseID)
+	ctx := context.Background()
+
+	order := func() []int {
+		t.Helper()
+		modules, err := s.Modules().ForCourse(ctx, courseID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, m := range modules {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	rec := adminCourseRequest(h, "POST", path, `{"title":"Setup","order":1}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d; body %s", rec.Code, rec.Body)
+	}
+	var created models.CourseModule
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Order != 1 || fmt.Sprint(order()) != fmt.Sprint([]int{created.ID, first, second}) {
+		t.Errorf("after create: order %d, modules %v", created.Order, order())
+	}
+
+	rec = adminCourseRequest(h, "PUT", fmt.Sprintf("%s/%d", path, first), `{"content":"Hello","autoGenerated":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d; body %s", rec.Code, rec.Body)
+	}
+	if m, err := s.Modules().Get(ctx, courseID, first); err != nil || m.Content != "Hello" || !m.AutoGenerated || m.Title != "Module 1" {
+		t.Errorf("after update: %+v, %v", m, err)
+	}
+
+	rec = adminCourseRequest(h, "PUT", path+"/reorder", fmt.Sprintf(`{"moduleIds":[%d,%d,%d]}`, second, created.ID, first))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reorder: status = %d; body %s", rec.Code, rec.Body)
+	}
+	if got := fmt.Sprint(order()); got != fmt.Sprint([]int{second, created.ID, first}) {
+		t.Errorf("after reorder: %s", got)
+	}
+	rec = adminCourseRequest(h, "PUT", path+"/reorder", fmt.Sprintf(`{"moduleIds":[%d,%d,%d]}`, second, second, first))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reorder with a duplicate: status = %d, want 400", rec.Code)
+	}
+
+	rec = adminCourseRequest(h, "DELETE", fmt.Sprintf("%s/%d", path, created.ID), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d; body %s", rec.Code, rec.Body)
+	}
+	modules, _ := s.Modules().ForCourse(ctx, courseID)
+	if len(modules) != 2 || modules[0].ID != second || modules[1].Order != 2 {
+		t.Errorf("after delete: %+v", modules)
+	}
+	if rec := adminCourseRequest(h, "GET", fmt.Sprintf("%s/%d", path, created.ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted module: status = %d, want 404", rec.Code)
+	}
+
+	entries, err := s.Audit().List(ctx, repository.AuditFilter{}, 0, 10)
+	if err != nil || len(entries) != 4 {
+		t.Errorf("audit entries = %d, %v; want 4", len(entries), err)
+	}
+}
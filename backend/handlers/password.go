@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"backend/repository"
+	"backend/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password reset tokens are opaque, stored only as SHA-256 hashes, expire
+// after utils.PasswordResetTTL and are marked used on first redemption.
+// Requesting a new link invalidates any outstanding ones.
+
+const minPasswordLength = 8
+
+const forgotPasswordMessage = "If an account exists for that email, a reset link has been sent"
+
+// frontendURL builds a link into the web app, whose base is APP_URL.
+func frontendURL(path string, query url.Values) string {
+	link := config.App.AppURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or not
+// the email belongs to an account so it cannot be used to probe for users.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "email is required", nil)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if !allowMailRequest(w, r, h.Store.Throttles(), email) {
+		return
+	}
+	// The lookup and the email happen after the response so its timing
+	// does not depend on whether the account exists.
+	ip := clientIP(r)
+	inBackground(r, "sending password reset", func(ctx context.Context) error {
+		return sendPasswordReset(ctx, h.Store, ip, email)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordMessage})
+}
+
+func sendPasswordReset(ctx context.Context, store repository.Store, ip, email string) error {
+	user, err := store.Users().FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("Password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	userID, username := user.ID, user.Username
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = store.WithTx(ctx, func(store repository.Store) error {
+		return store.PasswordResets().Replace(ctx, models.PasswordReset{
+			UserID: userID, Hash: hash, ExpiresAt: time.Now().Add(utils.PasswordResetTTL), IP: ip,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL("/reset-password", url.Values{"token": {token}})
+	log.Printf("Password reset issued for user %d", userID)
+	return mailer.Default().Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: "Hi " + username + ",\n\n" +
+			"Use the link below to choose a new password. It expires in " +
+			utils.PasswordResetTTL.String() + " and can be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	})
+}
+
+// ResetPassword redeems a reset token, sets the new password and revokes
+// every refresh token of the account so other sessions must log in again.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "token and password are required", nil)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation, "Password is too short",
+			map[string]interface{}{"minLength": minPasswordLength})
+		return
+	}
+
+	ctx := r.Context()
+	var userID int
+	var revoked int64
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		t, err := store.PasswordResets().Lock(ctx, utils.HashToken(req.Token))
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && t.UsedAt != nil) {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidReset, "Reset link is invalid or has already been used", nil)
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading password reset token: %w", err)
+		}
+		if time.Now().After(t.ExpiresAt) {
+			writeAPIError(w, http.StatusBadRequest, errCodeResetExpired, "Reset link has expired", nil)
+			return errResponseWritten
+		}
+		userID = t.UserID
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hashing password: %w", err)
+		}
+
+		if err := store.PasswordResets().Redeem(ctx, t); err != nil {
+			return fmt.Errorf("redeeming reset token %d: %w", t.ID, err)
+		}
+		if err := store.Users().SetPassword(ctx, userID, string(hashedPassword)); err != nil {
+			return fmt.Errorf("updating password: %w", err)
+		}
+		if revoked, err = store.Sessions().RevokeUser(ctx, userID, "password_reset"); err != nil {
+			return fmt.Errorf("revoking sessions: %w", err)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "password.reset", TargetType: "user", TargetID: userID, ActorID: userID,
+			After: map[string]interface{}{"resetTokenId": t.ID, "sessionsRevoked": revoked},
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("Password reset for user %d; revoked %d refresh tokens", userID, revoked)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset. Please log in again."})
+}
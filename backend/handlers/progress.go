@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+)
+
+// ProgressHandler records module completions and keeps the course and
+// global progress derived from them up to date.
+type ProgressHandler struct {
+	Store repository.Store
+}
+
+type courseProgress struct {
+	CourseID         int `json:"courseId"`
+	CompletedModules int `json:"completedModules"`
+	TotalModules     int `json:"totalModules"`
+	Progress         int `json:"progress"`
+}
+
+func percent(completed, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	if completed > total {
+		completed = total
+	}
+	return completed * 100 / total
+}
+
+// getGlobalProgress computes a learner's overall progress from the courses
+// they are enrolled in: completed modules over total modules of those
+// courses. Courses the learner never started or has dropped do not dilute
+// the number, and archived courses are left out until they are restored.
+func getGlobalProgress(ctx context.Context, enrollments repository.EnrollmentRepository, userID int) (progress, completed, total int, err error) {
+	completed, total, err = enrollments.ModuleTotals(ctx, userID)
+	return percent(completed, total), completed, total, err
+}
+
+// UpdateProgress marks a module as completed or not, enrolling the learner
+// or resuming their enrollment as needed, and returns the course and global
+// progress that follow from it.
+func (h *ProgressHandler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	slog.Debug("UpdateProgress handler called")
+
+	userID := middleware.MustPrincipal(r.Context()).ID
+
+	var req struct {
+		CourseID  int  `json:"courseId"`
+		ModuleID  int  `json:"moduleId"`
+		Completed bool `json:"completed"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	if req.CourseID <= 0 || req.ModuleID <= 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation,
+			"courseId and moduleId must be positive integers",
+			map[string]interface{}{"courseId": req.CourseID, "moduleId": req.ModuleID})
+		return
+	}
+
+	log.Printf("Updating progress for user ID: %d, course ID: %d, module ID: %d, completed: %v",
+		userID, req.CourseID, req.ModuleID, req.Completed)
+
+	ctx := r.Context()
+	var courseCompleted bool
+	var completedCourses, progress int
+	var courseProgress courseProgress
+
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		courseExists, err := store.Courses().Exists(ctx, req.CourseID)
+		if err != nil {
+			return err
+		}
+		if !courseExists {
+			log.Printf("Rejecting progress update: course %d does not exist", req.CourseID)
+			writeAPIError(w, http.StatusNotFound, errCodeCourseNotFound, "Course not found",
+				map[string]interface{}{"courseId": req.CourseID})
+			return errResponseWritten
+		}
+
+		moduleCourseID, err := store.Modules().CourseID(ctx, req.ModuleID)
+		if errors.Is(err, repository.ErrNotFound) {
+			log.Printf("Rejecting progress update: module %d does not exist", req.ModuleID)
+			writeAPIError(w, http.StatusNotFound, errCodeModuleNotFound, "Module not found",
+				map[string]interface{}{"moduleId": req.ModuleID})
+			return errResponseWritten
+		}
+		if err != nil {
+			return err
+		}
+
+		if moduleCourseID != req.CourseID {
+			log.Printf("Rejecting progress update: module %d belongs to course %d, not %d",
+				req.ModuleID, moduleCourseID, req.CourseID)
+			writeAPIError(w, http.StatusUnprocessableEntity, errCodeModuleMismatch,
+				"Module does not belong to this course",
+				map[string]interface{}{"courseId": req.CourseID, "moduleId": req.ModuleID})
+			return errResponseWritten
+		}
+
+		enrollmentStatus, err := store.Enrollments().Status(ctx, userID, req.CourseID)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			if !requireVerifiedUser(ctx, w, store.Users(), userID) {
+				return errResponseWritten
+			}
+			log.Printf("User %d not enrolled in course %d, enrolling now", userID, req.CourseID)
+			_, err = store.Enrollments().Transition(ctx, userID, req.CourseID, models.EnrollmentActive)
+		case err != nil:
+			// handled below
+		case enrollmentStatus == models.EnrollmentPaused || enrollmentStatus == models.EnrollmentDropped:
+			log.Printf("User %d resumed course %d (was %s)", userID, req.CourseID, enrollmentStatus)
+			_, err = store.Enrollments().Transition(ctx, userID, req.CourseID, models.EnrollmentActive)
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Completed {
+			log.Printf("Marking module %d as completed for user %d", req.ModuleID, userID)
+			err = store.Modules().Complete(ctx, userID, req.CourseID, req.ModuleID)
+		} else {
+			log.Printf("Unmarking module %d as completed for user %d", req.ModuleID, userID)
+			err = store.Modules().Uncomplete(ctx, userID, req.ModuleID)
+		}
+		if err != nil {
+			return err
+		}
+
+		courseProgress.CourseID = req.CourseID
+		courseProgress.CompletedModules, courseProgress.TotalModules, err = store.Modules().Progress(ctx, userID, req.CourseID)
+		if err != nil {
+			return err
+		}
+		courseProgress.Progress = percent(courseProgress.CompletedModules, courseProgress.TotalModules)
+
+		if courseProgress.TotalModules > 0 && courseProgress.CompletedModules >= courseProgress.TotalModules {
+			courseCompleted = true
+			if err := store.Enrollments().MarkCompleted(ctx, userID, req.CourseID); err != nil {
+				return err
+			}
+			log.Printf("Course %d marked as completed for user %d", req.CourseID, userID)
+		} else if err := store.Enrollments().Reopen(ctx, userID, req.CourseID); err != nil {
+			return err
+		}
+
+		var completedModules, totalModules int
+		progress, completedModules, totalModules, err = getGlobalProgress(ctx, store.Enrollments(), userID)
+		if err != nil {
+			return err
+		}
+
+		completedCourses, err = store.Enrollments().CountCompleted(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Global progress for user %d: %d%% (%d/%d modules completed across enrolled courses)",
+			userID, progress, completedModules, totalModules)
+		log.Printf("Completed courses for user %d: %d", userID, completedCourses)
+
+		return store.Users().SetProgress(ctx, userID, progress, completedCourses)
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating progress: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":          true,
+		"courseCompleted":  courseCompleted,
+		"completedCourses": completedCourses,
+		"progress":         progress,
+		"courseProgress":   courseProgress,
+		"message":          "Progress updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
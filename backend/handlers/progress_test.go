@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+)
+
+// progressFixture is a learner with a two-module course and a second course
+// with a module of its own.
+type progressFixture struct {
+	store                 *repository.MemoryStore
+	userID                int
+	courseID, otherCourse int
+	modules               []int
+	otherModule           int
+}
+
+func newProgressFixture(t *testing.T, verified bool) progressFixture {
+	t.Helper()
+	s := repository.NewMemoryStore()
+	f := progressFixture{store: s, userID: s.AddUser(verified)}
+	f.courseID = s.AddCourse("React Native Basics")
+	f.modules = []int{s.AddModule(f.courseID), s.AddModule(f.courseID)}
+	f.otherCourse = s.AddCourse("Advanced Navigation")
+	f.otherModule = s.AddModule(f.otherCourse)
+	return f
+}
+
+func (f progressFixture) enroll(t *testing.T, status string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := f.store.Enrollments().Transition(ctx, f.userID, f.courseID, models.EnrollmentActive); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if status == models.EnrollmentActive {
+		return
+	}
+	if _, err := f.store.Enrollments().Transition(ctx, f.userID, f.courseID, status); err != nil {
+		t.Fatalf("move enrollment to %s: %v", status, err)
+	}
+}
+
+func (f progressFixture) complete(t *testing.T, moduleID int) {
+	t.Helper()
+	if err := f.store.Modules().Complete(context.Background(), f.userID, f.courseID, moduleID); err != nil {
+		t.Fatalf("complete module %d: %v", moduleID, err)
+	}
+}
+
+func (f progressFixture) update(courseID, moduleID int, completed bool) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"courseId":%d,"moduleId":%d,"completed":%t}`, courseID, moduleID, completed)
+	req := httptest.NewRequest(http.MethodPost, "/api/progress/update", strings.NewReader(body))
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), &middleware.Principal{ID: f.userID}))
+	rec := httptest.NewRecorder()
+	(&ProgressHandler{Store: f.store}).UpdateProgress(rec, req)
+	return rec
+}
+
+func TestUpdateProgress(t *testing.T) {
+	tests := []struct {
+		name       string
+		unverified bool
+		setup      func(t *testing.T, f progressFixture)
+		// request returns courseId, moduleId and completed.
+		request func(f progressFixture) (int, int, bool)
+
+		wantStatus       int
+		wantCode         string
+		wantEnrollment   string
+		wantCompleted    int
+		wantCourseDone   bool
+		wantProgress     int
+		wantCompletedCnt int
+	}{
+		{
+			name:       "unknown module",
+			request:    func(f progressFixture) (int, int, bool) { return f.courseID, 9999, true },
+			wantStatus: http.StatusNotFound,
+			wantCode:   errCodeModuleNotFound,
+		},
+		{
+			name:       "unknown course",
+			request:    func(f progressFixture) (int, int, bool) { return 9999, f.modules[0], true },
+			wantStatus: http.StatusNotFound,
+			wantCode:   errCodeCourseNotFound,
+		},
+		{
+			name:       "module in another course",
+			request:    func(f progressFixture) (int, int, bool) { return f.courseID, f.otherModule, true },
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   errCodeModuleMismatch,
+		},
+		{
+			name:           "auto-enrolls a verified learner",
+			request:        func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[0], true },
+			wantStatus:     http.StatusOK,
+			wantEnrollment: models.EnrollmentActive,
+			wantCompleted:  1,
+			wantProgress:   50,
+		},
+		{
+			name:       "does not auto-enroll an unverified learner",
+			unverified: true,
+			request:    func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[0], true },
+			wantStatus: http.StatusForbidden,
+			wantCode:   errCodeEmailNotVerified,
+		},
+		{
+			name:           "resumes a paused enrollment",
+			setup:          func(t *testing.T, f progressFixture) { f.enroll(t, models.EnrollmentPaused) },
+			request:        func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[0], true },
+			wantStatus:     http.StatusOK,
+			wantEnrollment: models.EnrollmentActive,
+			wantCompleted:  1,
+			wantProgress:   50,
+		},
+		{
+			name:           "resumes a dropped enrollment",
+			setup:          func(t *testing.T, f progressFixture) { f.enroll(t, models.EnrollmentDropped) },
+			request:        func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[1], true },
+			wantStatus:     http.StatusOK,
+			wantEnrollment: models.EnrollmentActive,
+			wantCompleted:  1,
+			wantProgress:   50,
+		},
+		{
+			name: "completing the last module completes the course",
+			setup: func(t *testing.T, f progressFixture) {
+				f.enroll(t, models.EnrollmentActive)
+				f.complete(t, f.modules[0])
+			},
+			request:          func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[1], true },
+			wantStatus:       http.StatusOK,
+			wantEnrollment:   models.EnrollmentCompleted,
+			wantCompleted:    2,
+			wantCourseDone:   true,
+			wantProgress:     100,
+			wantCompletedCnt: 1,
+		},
+		{
+			name: "unmarking a module of a completed course reopens it",
+			setup: func(t *testing.T, f progressFixture) {
+				f.enroll(t, models.EnrollmentActive)
+				f.complete(t, f.modules[0])
+				f.complete(t, f.modules[1])
+				if err := f.store.Enrollments().MarkCompleted(context.Background(), f.userID, f.courseID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			request:        func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[1], false },
+			wantStatus:     http.StatusOK,
+			wantEnrollment: models.EnrollmentActive,
+			wantCompleted:  1,
+			wantProgress:   50,
+		},
+		{
+			name: "unmarking a module",
+			setup: func(t *testing.T, f progressFixture) {
+				f.enroll(t, models.EnrollmentActive)
+				f.complete(t, f.modules[0])
+			},
+			request:        func(f progressFixture) (int, int, bool) { return f.courseID, f.modules[0], false },
+			wantStatus:     http.StatusOK,
+			wantEnrollment: models.EnrollmentActive,
+			wantCompleted:  0,
+			wantProgress:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProgressFixture(t, !tt.unverified)
+			if tt.setup != nil {
+				tt.setup(t, f)
+			}
+			courseID, moduleID, completed := tt.request(f)
+			rec := f.update(courseID, moduleID, completed)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			ctx := context.Background()
+
+			if tt.wantCode != "" {
+				var got apiError
+				if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+					t.Fatalf("decode error body: %v", err)
+				}
+				if got.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", got.Code, tt.wantCode)
+				}
+				if _, err := f.store.Enrollments().Status(ctx, f.userID, f.courseID); !errors.Is(err, repository.ErrNotFound) {
+					t.Errorf("rejected update left an enrollment behind (err = %v)", err)
+				}
+				return
+			}
+
+			var got struct {
+				CourseCompleted  bool           `json:"courseCompleted"`
+				CompletedCourses int            `json:"completedCourses"`
+				Progress         int            `json:"progress"`
+				CourseProgress   courseProgress `json:"courseProgress"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if got.CourseCompleted != tt.wantCourseDone || got.Progress != tt.wantProgress ||
+				got.CompletedCourses != tt.wantCompletedCnt || got.CourseProgress.CompletedModules != tt.wantCompleted ||
+				got.CourseProgress.TotalModules != len(f.modules) {
+				t.Errorf("response = %+v", got)
+			}
+
+			status, err := f.store.Enrollments().Status(ctx, f.userID, f.courseID)
+			if err != nil || status != tt.wantEnrollment {
+				t.Errorf("enrollment status = %q, %v; want %q", status, err, tt.wantEnrollment)
+			}
+			done, err := f.store.Modules().Completed(ctx, f.userID, f.courseID)
+			if err != nil || len(done) != tt.wantCompleted {
+				t.Errorf("completed modules = %v, %v; want %d", done, err, tt.wantCompleted)
+			}
+			if progress, completedCourses := f.store.UserProgress(f.userID); progress != tt.wantProgress ||
+				completedCourses != tt.wantCompletedCnt {
+				t.Errorf("stored progress = %d%%, %d courses; want %d%%, %d",
+					progress, completedCourses, tt.wantProgress, tt.wantCompletedCnt)
+			}
+		})
+	}
+}
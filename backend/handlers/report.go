@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DanglingProgressReport lists completed_modules rows that no longer point at
+// a valid module of their course. Nothing is modified; admins decide how to
+// clean up (restore the module, remap the progress or delete it).
+//
+// Reasons:
+//   - module_missing: the module row no longer exists
+//   - course_mismatch: the module exists but belongs to another course
+//   - auto_generated: the module is flagged placeholder content
+func (h *ProgressHandler) DanglingProgressReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	dangling, err := h.Store.Modules().Dangling(r.Context())
+	if err != nil {
+		log.Printf("Error querying dangling progress: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+
+	entries := []map[string]interface{}{}
+	byReason := map[string]int{}
+	users := map[int]bool{}
+	for _, c := range dangling {
+		entry := map[string]interface{}{
+			"userId":   c.UserID,
+			"courseId": c.CourseID,
+			"moduleId": c.ModuleID,
+			"reason":   c.Reason,
+		}
+		if c.CompletedAt != nil {
+			entry["completedAt"] = c.CompletedAt.Format(time.RFC3339)
+		}
+		if c.ModuleCourseID != nil && *c.ModuleCourseID != c.CourseID {
+			entry["moduleCourseId"] = *c.ModuleCourseID
+		}
+
+		entries = append(entries, entry)
+		byReason[c.Reason]++
+		users[c.UserID] = true
+	}
+
+	log.Printf("Dangling progress report: %d entries affecting %d users", len(entries), len(users))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generatedAt":   time.Now().Format(time.RFC3339),
+		"total":         len(entries),
+		"affectedUsers": len(users),
+		"byReason":      byReason,
+		"entries":       entries,
+	})
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"backend/middleware"
+	"backend/models"
+	"backend/repository"
+	"backend/utils"
+)
+
+// Refresh tokens are opaque random strings stored only as SHA-256 hashes.
+// Each login starts a family; every refresh marks the presented token used
+// and issues a successor in the same family. Presenting a used or revoked
+// token means it was copied, so the whole family is revoked.
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	Role         string `json:"role"`
+	// TwoFactorSetupRequired tells the client that the role requires 2FA
+	// and the account has not enrolled yet.
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// issueSession signs an access token and stores a new refresh token in the
+// given family. An empty familyID starts a new family. mfa is carried over
+// to refreshed sessions of the same family.
+func issueSession(ctx context.Context, sessions repository.SessionRepository, r *http.Request, userID int, username, role, familyID string, mfa bool) (tokenResponse, error) {
+	accessToken, err := utils.GenerateToken(userID, username, role, mfa)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	refreshToken, hash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	if familyID == "" {
+		// The first token's hash is unique and never leaves the server.
+		familyID = hash[:32]
+	}
+
+	err = sessions.Create(ctx, models.RefreshToken{
+		UserID: userID, FamilyID: familyID, Hash: hash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+		UserAgent: r.UserAgent(), IP: clientIP(r), MFA: mfa,
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		Token:                  accessToken,
+		RefreshToken:           refreshToken,
+		TokenType:              "Bearer",
+		ExpiresIn:              int(utils.AccessTokenTTL.Seconds()),
+		Role:                   role,
+		TwoFactorSetupRequired: middleware.MFARequired(role) && !mfa,
+	}, nil
+}
+
+var (
+	errRefreshReused  = errors.New("refresh token already used or revoked")
+	errRefreshExpired = errors.New("refresh token expired")
+)
+
+// checkRefreshToken reports whether the token may be rotated at now. A used
+// or revoked token counts as reused even once it has expired, so replaying
+// a stolen copy always revokes its family.
+func checkRefreshToken(t models.RefreshToken, now time.Time) error {
+	if t.UsedAt != nil || t.RevokedAt != nil {
+		return errRefreshReused
+	}
+	if now.After(t.ExpiresAt) {
+		return errRefreshExpired
+	}
+	return nil
+}
+
+func decodeRefreshToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "refreshToken is required", nil)
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	presented, ok := decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var session tokenResponse
+	reused := false
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		t, err := store.Sessions().Lock(ctx, utils.HashToken(presented))
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusUnauthorized, errCodeInvalidRefresh, "Invalid refresh token", nil)
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading refresh token: %w", err)
+		}
+
+		switch err := checkRefreshToken(t, time.Now()); {
+		case errors.Is(err, errRefreshReused):
+			log.Printf("Refresh token reuse detected for user %d, revoking family %s", t.UserID, t.FamilyID)
+			if err := store.Sessions().RevokeFamily(ctx, t.FamilyID, "reuse_detected"); err != nil {
+				return fmt.Errorf("revoking refresh token family: %w", err)
+			}
+			// The revocation commits; the client is told once it has.
+			reused = true
+			return nil
+		case errors.Is(err, errRefreshExpired):
+			writeAPIError(w, http.StatusUnauthorized, errCodeRefreshExpired, "Refresh token has expired", nil)
+			return errResponseWritten
+		}
+
+		user, err := store.Users().Admin(ctx, t.UserID)
+		if err != nil {
+			log.Printf("Error loading user %d for refresh: %v", t.UserID, err)
+			writeAPIError(w, http.StatusUnauthorized, errCodeInvalidRefresh, "Invalid refresh token", nil)
+			return errResponseWritten
+		}
+		if user.SuspendedAt != nil {
+			writeAPIError(w, http.StatusForbidden, errCodeAccountSuspended, "This account has been suspended", nil)
+			return errResponseWritten
+		}
+
+		if err := store.Sessions().MarkUsed(ctx, t.ID); err != nil {
+			return fmt.Errorf("marking refresh token used: %w", err)
+		}
+		session, err = issueSession(ctx, store.Sessions(), r, t.UserID, user.Username, user.Role, t.FamilyID, t.MFA)
+		if err != nil {
+			return fmt.Errorf("issuing session: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error refreshing session: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if reused {
+		writeAPIError(w, http.StatusUnauthorized, errCodeRefreshReused,
+			"Refresh token has already been used; please log in again", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// Logout revokes the session (refresh token family) of the presented token.
+// It succeeds for unknown tokens so clients can always clear local state.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	presented, ok := decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Store.Sessions().RevokeFamilyOf(r.Context(), utils.HashToken(presented), "logout"); err != nil {
+		log.Printf("Error revoking session: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+// LogoutAll revokes every refresh token of the authenticated user.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := middleware.MustPrincipal(r.Context()).ID
+
+	revoked, err := h.Store.Sessions().RevokeUser(r.Context(), userID, "logout_all")
+	if err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("Revoked %d refresh tokens for user %d", revoked, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Logged out from all sessions",
+		"revokedTokens": revoked,
+	})
+}
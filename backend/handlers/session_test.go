@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/models"
+	"backend/repository"
+	"backend/utils"
+)
+
+func initTestTokens(t *testing.T) {
+	t.Helper()
+	if err := utils.InitTokenService(utils.TokenConfig{Secret: "test-secret"}); err != nil {
+		t.Fatalf("InitTokenService: %v", err)
+	}
+}
+
+func TestStoredRefreshTokenCheck(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		token models.RefreshToken
+		want  error
+	}{
+		{"fresh", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, nil},
+		{"expires now", models.RefreshToken{ExpiresAt: now}, nil},
+		{"expired", models.RefreshToken{ExpiresAt: earlier}, errRefreshExpired},
+		{"used", models.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &earlier}, errRefreshReused},
+		{"revoked", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &earlier}, errRefreshReused},
+		{"used and expired", models.RefreshToken{ExpiresAt: earlier, UsedAt: &earlier}, errRefreshReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRefreshToken(tt.token, now); !errors.Is(err, tt.want) {
+				t.Errorf("checkRefreshToken() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueSessionFamilies(t *testing.T) {
+	initTestTokens(t)
+	r := httptest.NewRequest("POST", "/api/login", nil)
+	sessions := repository.NewMemoryStore().Sessions()
+	ctx := context.Background()
+
+	login, err := issueSession(ctx, sessions, r, 7, "ada", "learner", "", false)
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+	hash := utils.HashToken(login.RefreshToken)
+	stored, err := sessions.Lock(ctx, hash)
+	if err != nil {
+		t.Fatalf("issued refresh token was not stored: %v", err)
+	}
+	if stored.FamilyID != hash[:32] {
+		t.Errorf("new login family = %q, want the prefix of its first token hash", stored.FamilyID)
+	}
+
+	refreshed, err := issueSession(ctx, sessions, r, 7, "ada", "learner", stored.FamilyID, true)
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("rotation reissued the same refresh token")
+	}
+	rotated, err := sessions.Lock(ctx, utils.HashToken(refreshed.RefreshToken))
+	if err != nil {
+		t.Fatalf("rotated refresh token was not stored: %v", err)
+	}
+	if rotated.FamilyID != stored.FamilyID {
+		t.Errorf("rotated token family = %q, want %q", rotated.FamilyID, stored.FamilyID)
+	}
+	if !rotated.MFA {
+		t.Error("rotation dropped the mfa flag")
+	}
+}
+
+func refreshRequest(h *AuthHandler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{"refreshToken":"`+token+`"}`))
+	rec := httptest.NewRecorder()
+	h.RefreshToken(rec, req)
+	return rec
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	initTestTokens(t)
+	s := repository.NewMemoryStore()
+	userID := s.AddUser(true)
+	h := &AuthHandler{Store: s}
+	ctx := context.Background()
+
+	login, err := issueSession(ctx, s.Sessions(), httptest.NewRequest("POST", "/api/login", nil), userID, "ada", "learner", "", false)
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	rec := refreshRequest(h, login.RefreshToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first refresh: status = %d; body %s", rec.Code, rec.Body)
+	}
+	var rotated tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&rotated); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := refreshRequest(h, login.RefreshToken); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	successor, err := s.Sessions().Lock(ctx, utils.HashToken(rotated.RefreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if successor.RevokedAt == nil {
+		t.Error("replaying a used token left its family's successor usable")
+	}
+}
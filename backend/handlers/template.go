@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/models"
+	"backend/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// templateCourseTitle is replaced with the course title when a template is
+// applied, so one template can produce titles like "Pengenalan Go".
+const templateCourseTitle = "{{courseTitle}}"
+
+// applyTemplate appends the template's modules to a course and returns the
+// IDs of the inserted rows.
+func applyTemplate(ctx context.Context, modules repository.ModuleRepository, courseID int, courseTitle string, t models.CourseTemplate) ([]int, error) {
+	count, err := modules.Count(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(t.Modules))
+	for i, m := range t.Modules {
+		id, err := modules.Create(ctx, models.CourseModule{
+			CourseID:    courseID,
+			Title:       strings.ReplaceAll(m.Title, templateCourseTitle, courseTitle),
+			Description: strings.ReplaceAll(m.Description, templateCourseTitle, courseTitle),
+			Content:     strings.ReplaceAll(m.Content, templateCourseTitle, courseTitle),
+			VideoUrl:    m.VideoUrl,
+			Order:       count + i + 1,
+		})
+		if err != nil {
+			return ids, fmt.Errorf("inserting template module %d: %w", i+1, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func decodeTemplate(r *http.Request) (models.CourseTemplate, error) {
+	var t models.CourseTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return t, fmt.Errorf("Invalid request format: %v", err)
+	}
+
+	t.Name = strings.TrimSpace(t.Name)
+	t.Level = strings.ToLower(strings.TrimSpace(t.Level))
+	if t.Name == "" {
+		return t, errors.New("Template name is required")
+	}
+	if t.Modules == nil {
+		t.Modules = []models.TemplateModule{}
+	}
+	for i, m := range t.Modules {
+		if strings.TrimSpace(m.Title) == "" {
+			return t, fmt.Errorf("Module %d: title is required", i+1)
+		}
+	}
+	return t, nil
+}
+
+// TemplateHandler serves the course templates.
+type TemplateHandler struct {
+	Store repository.Store
+}
+
+// CourseTemplates serves /api/admin/course-templates: GET lists the
+// templates and POST creates one.
+func (h *TemplateHandler) CourseTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		h.listTemplates(w, r)
+	case "POST":
+		h.createTemplate(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// CourseTemplateByID serves /api/admin/course-templates/{id}.
+func (h *TemplateHandler) CourseTemplateByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	templateID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/course-templates/"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		t, err := h.Store.Templates().Get(r.Context(), templateID)
+		if err != nil {
+			writeTemplateError(w, templateID, err)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+	case "PUT":
+		h.updateTemplate(w, r, templateID)
+	case "DELETE":
+		h.deleteTemplate(w, r, templateID)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writeTemplateError(w http.ResponseWriter, templateID int, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		writeJSONError(w, http.StatusConflict, "A template with this name already exists")
+		return
+	}
+	log.Printf("Error on template %d: %v", templateID, err)
+	writeJSONError(w, http.StatusInternalServerError, "Database error")
+}
+
+func (h *TemplateHandler) listTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.Store.Templates().List(r.Context())
+	if err != nil {
+		log.Printf("Error querying templates: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch templates")
+		return
+	}
+
+	json.NewEncoder(w).Encode(templates)
+}
+
+func (h *TemplateHandler) createTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := decodeTemplate(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	err = h.Store.WithTx(ctx, func(store repository.Store) error {
+		if t, err = store.Templates().Create(ctx, t); err != nil {
+			return err
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "template.create", TargetType: "template", TargetID: t.ID, After: t,
+		})
+	})
+	if err != nil {
+		writeTemplateError(w, 0, err)
+		return
+	}
+
+	log.Printf("Course template %d (%s) created", t.ID, t.Name)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *TemplateHandler) updateTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	t, err := decodeTemplate(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t.ID = templateID
+
+	ctx := r.Context()
+	err = h.Store.WithTx(ctx, func(store repository.Store) error {
+		before, err := store.Templates().Get(ctx, templateID)
+		if err != nil {
+			return err
+		}
+		if t, err = store.Templates().Update(ctx, t); err != nil {
+			return err
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "template.update", TargetType: "template", TargetID: templateID, Before: before, After: t,
+		})
+	})
+	if err != nil {
+		writeTemplateError(w, templateID, err)
+		return
+	}
+
+	log.Printf("Course template %d updated", templateID)
+
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *TemplateHandler) deleteTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		before, err := store.Templates().Delete(ctx, templateID)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "template.delete", TargetType: "template", TargetID: templateID, Before: before,
+		})
+	})
+	if err != nil {
+		writeTemplateError(w, templateID, err)
+		return
+	}
+
+	log.Printf("Course template %d deleted", templateID)
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Template deleted successfully"})
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Failed logins are counted in login_throttles per account (the submitted
+// email, whether or not it exists) and per client IP, so limits hold across
+// instances. After a few free attempts every further failure blocks the key
+// for an exponentially growing delay, up to a temporary lockout. Counters
+// decay once a key has been quiet for throttleWindow. Requests that send
+// email are counted the same way under their own scopes.
+
+const (
+	throttleScopeAccount = "account"
+	throttleScopeIP      = "ip"
+	throttleScopeMail    = "mail"
+	throttleScopeMailIP  = "mail_ip"
+
+	throttleWindow = time.Hour
+)
+
+type throttlePolicy struct {
+	freeAttempts int           // failures allowed before any delay
+	lockAfter    int           // failures that trigger the full lockout
+	lockout      time.Duration // maximum and lockout delay
+}
+
+var throttlePolicies = map[string]throttlePolicy{
+	throttleScopeAccount: {freeAttempts: 3, lockAfter: 10, lockout: 15 * time.Minute},
+	// Shared addresses (offices, NAT) see more honest failures.
+	throttleScopeIP: {freeAttempts: 10, lockAfter: 50, lockout: 15 * time.Minute},
+	// Password reset and verification emails are rarely needed more than
+	// a couple of times an hour.
+	throttleScopeMail:   {freeAttempts: 3, lockAfter: 10, lockout: time.Hour},
+	throttleScopeMailIP: {freeAttempts: 20, lockAfter: 100, lockout: time.Hour},
+}
+
+// delay returns how long a key stays blocked after its n-th failure.
+func (p throttlePolicy) delay(failures int) time.Duration {
+	if failures <= p.freeAttempts {
+		return 0
+	}
+	if failures >= p.lockAfter {
+		return p.lockout
+	}
+	// Doubling stops at the cap so large counts cannot overflow.
+	d := time.Second
+	for i := p.freeAttempts + 1; i < failures && d < p.lockout; i++ {
+		d *= 2
+	}
+	if d > p.lockout {
+		d = p.lockout
+	}
+	return d
+}
+
+// normalizeEmail is the form emails are stored and throttled under, so
+// addresses that differ only in case or surrounding space are one account.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginThrottleKeys(email, ip string) []repository.ThrottleKey {
+	return []repository.ThrottleKey{
+		{Scope: throttleScopeAccount, Key: normalizeEmail(email)},
+		{Scope: throttleScopeIP, Key: ip},
+	}
+}
+
+func mailThrottleKeys(email, ip string) []repository.ThrottleKey {
+	return []repository.ThrottleKey{
+		{Scope: throttleScopeMail, Key: normalizeEmail(email)},
+		{Scope: throttleScopeMailIP, Key: ip},
+	}
+}
+
+// loginBlockedFor returns how long login is still blocked for the account or
+// the IP, whichever is longer; zero means the attempt may proceed.
+func loginBlockedFor(ctx context.Context, throttles repository.ThrottleRepository, email, ip string) (time.Duration, error) {
+	return throttleBlockedFor(ctx, throttles, loginThrottleKeys(email, ip))
+}
+
+func recordLoginFailure(ctx context.Context, throttles repository.ThrottleRepository, email, ip string) error {
+	return recordThrottleHit(ctx, throttles, loginThrottleKeys(email, ip))
+}
+
+// throttleBlockedFor returns how long the longest block among keys still
+// lasts.
+func throttleBlockedFor(ctx context.Context, throttles repository.ThrottleRepository, keys []repository.ThrottleKey) (time.Duration, error) {
+	lockedUntil, err := throttles.LockedUntil(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	if remaining := time.Until(lockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// recordThrottleHit counts one attempt against every key and blocks those
+// that went over their scope's policy.
+func recordThrottleHit(ctx context.Context, throttles repository.ThrottleRepository, keys []repository.ThrottleKey) error {
+	for _, key := range keys {
+		failures, err := throttles.Hit(ctx, key, throttleWindow)
+		if err != nil {
+			return err
+		}
+
+		policy := throttlePolicies[key.Scope]
+		if d := policy.delay(failures); d > 0 {
+			if err := throttles.Lock(ctx, key, d); err != nil {
+				return err
+			}
+			if failures >= policy.lockAfter {
+				log.Printf("Throttle locked %s %q after %d attempts", key.Scope, key.Key, failures)
+			}
+		}
+	}
+	return nil
+}
+
+// writeTooManyRequests answers 429 with a Retry-After of blockedFor.
+func writeTooManyRequests(w http.ResponseWriter, blockedFor time.Duration, message string) {
+	retryAfter := int(math.Ceil(blockedFor.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeAPIError(w, http.StatusTooManyRequests, errCodeTooManyAttempts, message,
+		map[string]interface{}{"retryAfter": retryAfter})
+}
+
+// allowMailRequest counts a request that may send email to the given address
+// and writes a 429 once the address or the client IP has asked too often.
+// Unknown addresses are counted as well, so the limit reveals nothing about
+// which are registered.
+func allowMailRequest(w http.ResponseWriter, r *http.Request, throttles repository.ThrottleRepository, email string) bool {
+	keys := mailThrottleKeys(email, clientIP(r))
+	blockedFor, err := throttleBlockedFor(r.Context(), throttles, keys)
+	if err != nil {
+		log.Printf("Error checking mail throttle: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return false
+	}
+	if blockedFor > 0 {
+		writeTooManyRequests(w, blockedFor, "Too many requests, please try again later")
+		return false
+	}
+	if err := recordThrottleHit(r.Context(), throttles, keys); err != nil {
+		log.Printf("Error recording mail request: %v", err)
+	}
+	return true
+}
+
+// clearAccountThrottle resets the account counter after a successful login.
+// The IP counter is left to decay so one valid account cannot be used to
+// keep resetting it.
+func clearAccountThrottle(ctx context.Context, throttles repository.ThrottleRepository, email string) error {
+	_, err := throttles.Clear(ctx, repository.ThrottleKey{Scope: throttleScopeAccount, Key: normalizeEmail(email)})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// burnPasswordCheck spends the same bcrypt work as a real comparison so the
+// response time does not reveal whether an email is registered.
+func burnPasswordCheck(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+type loginThrottle struct {
+	Scope         string `json:"scope"`
+	Key           string `json:"key"`
+	UserID        *int   `json:"userId,omitempty"`
+	Failures      int    `json:"failures"`
+	LastFailureAt string `json:"lastFailureAt,omitempty"`
+	LockedUntil   string `json:"lockedUntil,omitempty"`
+	Locked        bool   `json:"locked"`
+}
+
+func newLoginThrottle(t models.LoginThrottle) loginThrottle {
+	return loginThrottle{
+		Scope:         t.Scope,
+		Key:           t.Key,
+		UserID:        t.UserID,
+		Failures:      t.Failures,
+		LastFailureAt: formatTimestamp(t.LastFailureAt),
+		LockedUntil:   formatTimestamp(t.LockedUntil),
+		Locked:        t.Locked,
+	}
+}
+
+// listLoginLockouts serves /api/admin/users/lockouts:
+//
+//	GET                 currently locked accounts and IPs
+//	DELETE ?ip=ADDRESS  clear the counter of one IP
+func (h *UserHandler) listLoginLockouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		locked, err := h.Store.Throttles().Locked(r.Context())
+		if err != nil {
+			log.Printf("Error querying login lockouts: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+
+		lockouts := []loginThrottle{}
+		for _, t := range locked {
+			lockouts = append(lockouts, newLoginThrottle(t))
+		}
+		json.NewEncoder(w).Encode(lockouts)
+	case "DELETE":
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "ip is required", nil)
+			return
+		}
+		cleared, err := h.clearThrottleAudited(r, repository.ThrottleKey{Scope: throttleScopeIP, Key: ip}, "ip", ip)
+		if err != nil {
+			log.Printf("Error clearing IP lockout: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		log.Printf("Cleared login throttle for IP %s", ip)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Lockout cleared",
+			"cleared": cleared,
+		})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleUserLockout serves /api/admin/users/{id}/lockout: GET shows the
+// account's failure counter, DELETE clears it.
+func (h *UserHandler) handleUserLockout(w http.ResponseWriter, r *http.Request, userID int) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := h.Store.Users().Admin(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found",
+			map[string]interface{}{"userId": userID})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	key := repository.ThrottleKey{Scope: throttleScopeAccount, Key: normalizeEmail(user.Email)}
+
+	switch r.Method {
+	case "GET":
+		t, err := h.Store.Throttles().Get(r.Context(), key)
+		if errors.Is(err, repository.ErrNotFound) {
+			t = models.LoginThrottle{Scope: key.Scope, Key: key.Key, UserID: &userID}
+		} else if err != nil {
+			log.Printf("Error loading lockout for user %d: %v", userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		json.NewEncoder(w).Encode(newLoginThrottle(t))
+	case "DELETE":
+		if _, err := h.clearThrottleAudited(r, key, "user", userID); err != nil {
+			log.Printf("Error clearing lockout for user %d: %v", userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		log.Printf("Cleared login lockout for user %d", userID)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Lockout cleared"})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// clearThrottleAudited removes one throttle counter on behalf of an admin and
+// records the counter it replaced. It reports whether there was one.
+func (h *UserHandler) clearThrottleAudited(r *http.Request, key repository.ThrottleKey, targetType string, targetID interface{}) (bool, error) {
+	ctx := r.Context()
+	cleared := false
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		t, err := store.Throttles().Clear(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cleared = true
+
+		before := map[string]interface{}{"failures": t.Failures}
+		if t.LockedUntil != nil {
+			before["lockedUntil"] = formatTimestamp(t.LockedUntil)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "lockout.clear", TargetType: targetType, TargetID: targetID, Before: before,
+		})
+	})
+	return cleared && err == nil, err
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/middleware"
+	"backend/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestThrottlePolicyDelay(t *testing.T) {
+	account := throttlePolicy{freeAttempts: 3, lockAfter: 10, lockout: 15 * time.Minute}
+	short := throttlePolicy{freeAttempts: 0, lockAfter: 100, lockout: 10 * time.Second}
+
+	tests := []struct {
+		name     string
+		policy   throttlePolicy
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", account, 0, 0},
+		{"last free attempt", account, 3, 0},
+		{"first delayed failure", account, 4, time.Second},
+		{"doubles", account, 5, 2 * time.Second},
+		{"keeps doubling", account, 9, 32 * time.Second},
+		{"lockout", account, 10, 15 * time.Minute},
+		{"beyond lockout", account, 25, 15 * time.Minute},
+		{"capped below lockout threshold", short, 5, 10 * time.Second},
+		{"cap holds for large counts", short, 99, 10 * time.Second},
+		{"ip policy before lockout", throttlePolicies[throttleScopeIP], 49, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.failures); got != tt.want {
+				t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottlePoliciesCoverScopes(t *testing.T) {
+	for _, scope := range []string{throttleScopeAccount, throttleScopeIP, throttleScopeMail, throttleScopeMailIP} {
+		p, ok := throttlePolicies[scope]
+		if !ok {
+			t.Errorf("no policy for scope %q", scope)
+			continue
+		}
+		if p.freeAttempts >= p.lockAfter || p.lockout <= 0 {
+			t.Errorf("scope %q: inconsistent policy %+v", scope, p)
+		}
+		// Scopes are stored in login_throttles.scope VARCHAR(10).
+		if len(scope) > 10 {
+			t.Errorf("scope %q is longer than the column allows", scope)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if got := normalizeEmail("  Ada@Example.COM "); got != "ada@example.com" {
+		t.Errorf("normalizeEmail = %q", got)
+	}
+}
+
+func TestChangePasswordThrottlesWrongPasswords(t *testing.T) {
+	s := repository.NewMemoryStore()
+	userID := s.AddUser(true)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users().SetPassword(context.Background(), userID, string(hashed)); err != nil {
+		t.Fatal(err)
+	}
+	h := &UserHandler{Store: s}
+
+	changePassword := func() int {
+		req := httptest.NewRequest("PUT", "/api/user/password",
+			strings.NewReader(`{"currentPassword":"wrong guess","newPassword":"new password"}`))
+		req = req.WithContext(middleware.WithPrincipal(req.Context(), &middleware.Principal{ID: userID, Role: middleware.RoleLearner}))
+		rec := httptest.NewRecorder()
+		h.ChangePassword(rec, req)
+		return rec.Code
+	}
+
+	free := throttlePolicies[throttleScopeAccount].freeAttempts
+	for i := 0; i <= free; i++ {
+		if code := changePassword(); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := changePassword(); code != http.StatusTooManyRequests {
+		t.Errorf("attempt after the free ones: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
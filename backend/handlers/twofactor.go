@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/middleware"
+	"backend/repository"
+	"backend/utils"
+)
+
+// Two-factor authentication uses TOTP (RFC 6238). Setup stores a pending
+// secret; confirming a first code enables it and returns one-time recovery
+// codes, which are stored hashed. Accounts with 2FA log in in two steps:
+// the password step returns a short-lived challenge token that is exchanged,
+// together with a code, at /api/login/2fa for a session marked mfa.
+
+const recoveryCodeCount = 10
+
+// errInvalidSecondFactor rolls back a transaction whose code was rejected;
+// the caller answers, and counts the failure, once the rollback is done.
+var errInvalidSecondFactor = errors.New("invalid authentication code")
+
+func writeTwoFactorChallenge(w http.ResponseWriter, userID int) {
+	challenge, err := utils.GenerateTwoFactorChallenge(userID)
+	if err != nil {
+		log.Printf("Error issuing two-factor challenge for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"twoFactorRequired": true,
+		"challengeToken":    challenge,
+		"expiresIn":         int(utils.TwoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+// and consumes it: the TOTP step is recorded so the code cannot be replayed
+// and the recovery code is marked used. It reports which method matched.
+func checkSecondFactor(ctx context.Context, twoFactor repository.TwoFactorRepository, userID int, code, recoveryCode string) (string, bool, error) {
+	if code != "" {
+		secret, err := twoFactor.Lock(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && secret.EnabledAt == nil) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		step, ok := utils.ValidateTOTP(secret.Secret, code, time.Now())
+		if !ok || step <= secret.LastUsedStep {
+			return "", false, nil
+		}
+		err = twoFactor.SetLastStep(ctx, userID, step)
+		return "totp", err == nil, err
+	}
+
+	if recoveryCode != "" {
+		ok, err := twoFactor.UseRecoveryCode(ctx, userID, utils.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			return "", false, err
+		}
+		return "recovery_code", ok, nil
+	}
+
+	return "", false, nil
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and returns a new set.
+func replaceRecoveryCodes(ctx context.Context, twoFactor repository.TwoFactorRepository, userID int) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	if err := twoFactor.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// LoginTwoFactor completes a login started by Login for an account with 2FA.
+// Failed codes count towards the same lockout as failed passwords.
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" ||
+		(req.Code == "" && req.RecoveryCode == "") {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest,
+			"challengeToken and either code or recoveryCode are required", nil)
+		return
+	}
+
+	userID, err := utils.VerifyTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidChallenge,
+			"Login session has expired, please log in again", nil)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.Store.Users().Admin(ctx, userID)
+	if err != nil {
+		log.Printf("Error loading user %d for two-factor login: %v", userID, err)
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidChallenge,
+			"Login session has expired, please log in again", nil)
+		return
+	}
+	if user.SuspendedAt != nil {
+		writeAPIError(w, http.StatusForbidden, errCodeAccountSuspended, "This account has been suspended", nil)
+		return
+	}
+
+	ip := clientIP(r)
+	blockedFor, err := loginBlockedFor(ctx, h.Store.Throttles(), user.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if blockedFor > 0 {
+		writeTooManyRequests(w, blockedFor, "Too many login attempts, please try again later")
+		return
+	}
+
+	var method string
+	var session tokenResponse
+	err = h.Store.WithTx(ctx, func(store repository.Store) error {
+		var ok bool
+		var err error
+		method, ok, err = checkSecondFactor(ctx, store.TwoFactor(), userID, req.Code, req.RecoveryCode)
+		if err != nil {
+			return fmt.Errorf("checking second factor: %w", err)
+		}
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		if err := clearAccountThrottle(ctx, store.Throttles(), user.Email); err != nil {
+			return fmt.Errorf("clearing login throttle: %w", err)
+		}
+		session, err = issueSession(ctx, store.Sessions(), r, userID, user.Username, user.Role, "", true)
+		if err != nil {
+			return fmt.Errorf("issuing session: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidSecondFactor) {
+		// The failure is counted once the transaction has rolled back.
+		if err := recordLoginFailure(ctx, h.Store.Throttles(), user.Email, ip); err != nil {
+			log.Printf("Error recording login failure: %v", err)
+		}
+		writeAPIError(w, http.StatusUnauthorized, errCodeInvalidTwoFactor, "Invalid authentication code", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error completing two-factor login for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if method == "recovery_code" {
+		log.Printf("User %d logged in with a recovery code", userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// TwoFactor manages the caller's own second factor:
+//
+//	GET  /api/2fa                 status
+//	POST /api/2fa/setup           new pending secret and otpauth URI
+//	POST /api/2fa/enable          {"code"} confirm setup; returns recovery codes
+//	POST /api/2fa/disable         {"password", "code"|"recoveryCode"}
+//	POST /api/2fa/recovery-codes  {"code"} replace recovery codes
+func (h *AuthHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	p := middleware.MustPrincipal(r.Context())
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/2fa"), "/")
+
+	if action == "" {
+		if r.Method != "GET" {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.twoFactorStatus(w, r, p)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		Password     string `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+			return
+		}
+	}
+
+	switch action {
+	case "setup":
+		h.setupTwoFactor(w, r, p)
+	case "enable":
+		h.enableTwoFactor(w, r, p, req.Code)
+	case "disable":
+		h.disableTwoFactor(w, r, p, req.Password, req.Code, req.RecoveryCode)
+	case "recovery-codes":
+		h.regenerateRecoveryCodes(w, r, p, req.Code)
+	default:
+		writeJSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *AuthHandler) twoFactorStatus(w http.ResponseWriter, r *http.Request, p *middleware.Principal) {
+	enabled, err := h.Store.TwoFactor().Enabled(r.Context(), p.ID)
+	var remaining int
+	if err == nil {
+		remaining, err = h.Store.TwoFactor().RecoveryCodesLeft(r.Context(), p.ID)
+	}
+	if err != nil {
+		log.Printf("Error loading two-factor status for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                enabled,
+		"required":               middleware.MFARequired(p.Role),
+		"sessionVerified":        p.MFA,
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+func (h *AuthHandler) setupTwoFactor(w http.ResponseWriter, r *http.Request, p *middleware.Principal) {
+	ctx := r.Context()
+	enabled, err := h.Store.TwoFactor().Enabled(ctx, p.ID)
+	if err != nil {
+		log.Printf("Error checking two-factor status for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if enabled {
+		writeAPIError(w, http.StatusConflict, errCodeTwoFactorEnabled,
+			"Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	user, err := h.Store.Users().Admin(ctx, p.ID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	if err := h.Store.TwoFactor().SetPending(ctx, p.ID, secret); err != nil {
+		log.Printf("Error storing TOTP secret for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":     secret,
+		"otpauthUri": utils.TOTPURI(config.App.TOTPIssuer, user.Email, secret),
+		"digits":     utils.TOTPDigits,
+		"period":     int(utils.TOTPPeriod.Seconds()),
+	})
+}
+
+func (h *AuthHandler) enableTwoFactor(w http.ResponseWriter, r *http.Request, p *middleware.Principal, code string) {
+	ctx := r.Context()
+	var codes []string
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		secret, err := store.TwoFactor().Lock(ctx, p.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeAPIError(w, http.StatusConflict, errCodeTwoFactorNotSetUp,
+				"Start two-factor setup first", nil)
+			return errResponseWritten
+		}
+		if err != nil {
+			return fmt.Errorf("loading TOTP secret: %w", err)
+		}
+		if secret.EnabledAt != nil {
+			writeAPIError(w, http.StatusConflict, errCodeTwoFactorEnabled,
+				"Two-factor authentication is already enabled", nil)
+			return errResponseWritten
+		}
+
+		step, ok := utils.ValidateTOTP(secret.Secret, code, time.Now())
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidTwoFactor, "Invalid authentication code", nil)
+			return errResponseWritten
+		}
+
+		if err := store.TwoFactor().Enable(ctx, p.ID, step); err != nil {
+			return fmt.Errorf("enabling two-factor: %w", err)
+		}
+		if codes, err = replaceRecoveryCodes(ctx, store.TwoFactor(), p.ID); err != nil {
+			return fmt.Errorf("creating recovery codes: %w", err)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "2fa.enable", TargetType: "user", TargetID: p.ID,
+			Before: map[string]bool{"enabled": false},
+			After:  map[string]interface{}{"enabled": true, "recoveryCodes": len(codes)},
+		})
+	})
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error enabling two-factor for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("User %d enabled two-factor authentication", p.ID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       true,
+		"recoveryCodes": codes,
+		"message":       "Two-factor authentication enabled. Store the recovery codes somewhere safe; they are shown only once.",
+	})
+}
+
+func (h *AuthHandler) disableTwoFactor(w http.ResponseWriter, r *http.Request, p *middleware.Principal, password, code, recoveryCode string) {
+	if middleware.MFARequired(p.Role) {
+		writeAPIError(w, http.StatusForbidden, errCodeTwoFactorRequired,
+			"Two-factor authentication is mandatory for your role", nil)
+		return
+	}
+
+	email, ok := checkReauthThrottle(w, r, h.Store, p.ID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		if err := checkCurrentPassword(ctx, store.Users(), p.ID, password); err != nil {
+			return err
+		}
+
+		_, ok, err := checkSecondFactor(ctx, store.TwoFactor(), p.ID, code, recoveryCode)
+		if err != nil {
+			return fmt.Errorf("checking second factor: %w", err)
+		}
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		if err := store.TwoFactor().Disable(ctx, p.ID); err != nil {
+			return fmt.Errorf("disabling two-factor: %w", err)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "2fa.disable", TargetType: "user", TargetID: p.ID,
+			Before: map[string]bool{"enabled": true},
+			After:  map[string]bool{"enabled": false},
+		})
+	})
+	if writeReauthFailure(w, r, h.Store.Throttles(), email, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error disabling two-factor for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("User %d disabled two-factor authentication", p.ID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": false,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *AuthHandler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, p *middleware.Principal, code string) {
+	email, ok := checkReauthThrottle(w, r, h.Store, p.ID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var codes []string
+	err := h.Store.WithTx(ctx, func(store repository.Store) error {
+		// Only a TOTP code is accepted here: a leaked recovery code must not
+		// be enough to mint a fresh set.
+		_, ok, err := checkSecondFactor(ctx, store.TwoFactor(), p.ID, code, "")
+		if err != nil {
+			return fmt.Errorf("checking second factor: %w", err)
+		}
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		if codes, err = replaceRecoveryCodes(ctx, store.TwoFactor(), p.ID); err != nil {
+			return fmt.Errorf("creating recovery codes: %w", err)
+		}
+		return recordAudit(ctx, store.Audit(), r, auditEvent{
+			Action: "2fa.recovery_codes_regenerate", TargetType: "user", TargetID: p.ID,
+			After: map[string]int{"recoveryCodes": len(codes)},
+		})
+	})
+	if writeReauthFailure(w, r, h.Store.Throttles(), email, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error regenerating recovery codes for user %d: %v", p.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
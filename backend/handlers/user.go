@@ -1,429 +1,246 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"backend/config"
-	"backend/utils"
-
-	"github.com/golang-jwt/jwt/v5"
+	"backend/middleware"
+	"backend/repository"
 )
 
-func GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+// UserHandler serves the learner's own account and the admin user list.
+type UserHandler struct {
+	Store repository.Store
+}
+
+// GetAllUsers serves /api/admin/users. GET lists users with optional
+// filters (q matches username or email, role, status of active, suspended
+// or unverified) one page at a time; the response stays a plain array and
+// the total is sent in X-Total-Count. POST creates a user.
+func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	if r.Method == "POST" {
+		h.createUser(w, r)
+		return
+	}
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+
+	query := r.URL.Query()
+	page, pageSize := 1, defaultUserPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "page must be a positive integer", nil)
+			return
+		}
+		page = n
 	}
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	
-	claims, err := utils.VerifyToken(tokenStr)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if v := query.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUserPageSize {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest,
+				fmt.Sprintf("pageSize must be between 1 and %d", maxUserPageSize), nil)
+			return
+		}
+		pageSize = n
+	}
+
+	filter := repository.UserFilter{
+		Query:  strings.TrimSpace(query.Get("q")),
+		Role:   query.Get("role"),
+		Status: query.Get("status"),
+	}
+	if filter.Role != "" && !middleware.ValidRole(filter.Role) {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest,
+			"role must be learner, instructor, content-editor or admin", nil)
 		return
 	}
-	
-	role, ok := claims["role"].(string)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	switch filter.Status {
+	case "", repository.UserActive, repository.UserSuspended, repository.UserUnverified:
+	default:
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest,
+			"status must be active, suspended or unverified", nil)
 		return
 	}
-	
-	rows, err := config.DB.Query(context.Background(), 
-		`SELECT id, email, username, role, 
-		COALESCE(progress, 0) as progress, 
-		COALESCE(completed_courses, 0) as completed_courses 
-		FROM users ORDER BY id`)
+
+	found, total, err := h.Store.Users().Search(r.Context(), filter, (page-1)*pageSize, pageSize)
 	if err != nil {
+		log.Printf("Error querying users: %v", err)
 		http.Error(w, "Gagal mengambil data user", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	
-	var users []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var email, username, role string
-		var progress, completed_courses int
-		
-		err := rows.Scan(&id, &email, &username, &role, &progress, &completed_courses)
-		if err != nil {
-			log.Printf("Error scanning user row: %v", err)
-			continue
+
+	users := []map[string]interface{}{}
+	for _, u := range found {
+		user := map[string]interface{}{
+			"id":                u.ID,
+			"email":             u.Email,
+			"username":          u.Username,
+			"role":              u.Role,
+			"progress":          u.Progress,
+			"completed_courses": u.CompletedCourses,
+			"emailVerified":     u.EmailVerifiedAt != nil,
+			"suspended":         u.SuspendedAt != nil,
 		}
-		
-		users = append(users, map[string]interface{}{
-			"id": id, 
-			"email": email, 
-			"username": username, 
-			"role": role,
-			"progress": progress,
-			"completed_courses": completed_courses,
-		})
+		if u.SuspendedAt != nil {
+			user["suspendedAt"] = formatTimestamp(u.SuspendedAt)
+		}
+		users = append(users, user)
 	}
-	
+
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Page, X-Page-Size")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Page", strconv.Itoa(page))
+	w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(users)
 }
 
-func GetUserProfile(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+func (h *UserHandler) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		return
 	}
-
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if r.Method == "PUT" {
+		h.UpdateUserProfile(w, r)
 		return
 	}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := utils.VerifyToken(token)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID := middleware.MustPrincipal(r.Context()).ID
 
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	profile, err := h.Store.Users().Profile(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found", nil)
 		return
 	}
-	userID := int(userIDFloat)
-
-	row := config.DB.QueryRow(context.Background(), 
-		`SELECT email, username, 
-		COALESCE(progress, 0) as progress, 
-		COALESCE(completed_courses, 0) as completed_courses,
-		COALESCE(status, 'Pemula React Native') as status
-		FROM users WHERE id=$1`, userID)
-	
-	var email, username, status string
-	var progress, completed_courses int
-	
-	err = row.Scan(&email, &username, &progress, &completed_courses, &status)
 	if err != nil {
 		log.Printf("Error fetching user profile: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, "Failed to fetch profile", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Returning profile for user ID %d: username=%s, email=%s", userID, username, email)
-
-	log.Printf("User profile for ID %d: progress=%d, completed_courses=%d", 
-		userID, progress, completed_courses)
-
-	var totalModules, completedModules int
-
-	err = config.DB.QueryRow(context.Background(), 
-		"SELECT COUNT(*) FROM course_modules").Scan(&totalModules)
-	
-	if err != nil {
-		log.Printf("Error counting total modules: %v", err)
+	slog.Debug("Returning profile", "userID", userID, "progress", profile.Progress, "completedCourses", profile.CompletedCourses)
 
-	} else {
-		log.Printf("Total modules across all courses: %d", totalModules)
-	}
-	
-	err = config.DB.QueryRow(context.Background(), 
-		"SELECT COUNT(*) FROM completed_modules WHERE user_id = $1", userID).Scan(&completedModules)
-	
+	updatedProgress, completedModules, totalModules, err := getGlobalProgress(r.Context(), h.Store.Enrollments(), userID)
 	if err != nil {
-		log.Printf("Error counting completed modules: %v", err)
-
-	} else {
-		log.Printf("Completed modules for user %d: %d", userID, completedModules)
+		log.Printf("Error computing global progress: %v", err)
+		updatedProgress = profile.Progress
 	}
-	
 
-	var updatedProgress int
-	
-	if totalModules > 0 {
-		updatedProgress = (completedModules * 100) / totalModules
-	}
-	
-	log.Printf("User %d global progress: %d%% (%d/%d modules completed across all courses)", 
+	log.Printf("User %d global progress: %d%% (%d/%d modules completed across enrolled courses)",
 		userID, updatedProgress, completedModules, totalModules)
-	
-	_, err = config.DB.Exec(context.Background(),
-		"UPDATE users SET progress = $1 WHERE id = $2", 
-		updatedProgress, userID)
-	
+
+	err = h.Store.Users().SetGlobalProgress(r.Context(), userID, updatedProgress)
 	if err != nil {
 		log.Printf("Error updating user progress: %v", err)
 	} else {
 		log.Printf("Updated global progress for user %d to %d%%", userID, updatedProgress)
 	}
-	
+
 	response := map[string]interface{}{
 		"id":                userID,
-		"username":          username,
-		"email":             email,
-		"role":              status,
+		"username":          profile.Username,
+		"email":             profile.Email,
+		"role":              profile.Role,
 		"progress":          updatedProgress,
-		"completed_courses": completed_courses,
-		"status":            status,
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func GetUserActivities(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	log.Println("GetUserActivities handler called")
-
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		log.Println("Unauthorized: No Bearer token")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		"completed_courses": profile.CompletedCourses,
+		"status":            profile.Status,
+		"emailVerified":     profile.EmailVerified,
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	
-	claims, err := utils.VerifyToken(tokenString)
-	if err != nil {
-		log.Printf("Unauthorized: Invalid token: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		log.Println("Invalid user ID in token claims")
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-	userID := int(userIDFloat)
-
-	rows, err := config.DB.Query(context.Background(), `
-		SELECT id, course_id, title, type, created_at
-		FROM user_activities
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT 10
-	`, userID)
 
-	if err != nil {
-		log.Printf("Error querying activities: %v", err)
-		http.Error(w, "Failed to fetch activities", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var activities []map[string]interface{}
-	for rows.Next() {
-		var id, courseID int
-		var title, activityType string
-		var createdAt time.Time
-		
-		err := rows.Scan(&id, &courseID, &title, &activityType, &createdAt)
-		if err != nil {
-			log.Printf("Error scanning activity row: %v", err)
-			continue
-		}
-		
-		activities = append(activities, map[string]interface{}{
-			"id":       id,
-			"courseId": courseID,
-			"title":    title,
-			"type":     activityType,
-			"date":     createdAt.Format(time.RFC3339),
-		})
-	}
-
-	log.Printf("Found %d activities for user ID: %d", len(activities), userID)
-	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(activities)
+	json.NewEncoder(w).Encode(response)
 }
 
-func GetRecommendedCourses(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+func (h *UserHandler) GetRecommendedCourses(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		return
 	}
 
-
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	token := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := utils.VerifyToken(token)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-	userID := int(userIDFloat)
-
+	userID := middleware.MustPrincipal(r.Context()).ID
 
 	log.Printf("Fetching recommended courses for user ID: %d", userID)
 
 	today := time.Now().Format("2006-01-02")
-	log.Printf("Today's date for course rotation: %s", today)
+	slog.Debug("Rotating recommended courses", "date", today)
 
 	dateHash := 0
 	for _, char := range today {
 		dateHash += int(char)
 	}
-	
-	var totalCourses int
-	err = config.DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM courses").Scan(&totalCourses)
+
+	totalCourses, err := h.Store.Courses().Count(r.Context())
 	if err != nil {
 		log.Printf("Error counting courses: %v", err)
 		http.Error(w, "Failed to count courses", http.StatusInternalServerError)
 		return
 	}
-	
+
 	log.Printf("Total courses in database: %d", totalCourses)
-	
+
 	if totalCourses == 0 {
 		log.Printf("No courses found in database")
 		http.Error(w, "No courses available", http.StatusNotFound)
 		return
 	}
-	
+
 	offset := dateHash % totalCourses
-	log.Printf("Using offset %d for today's recommendations", offset)
-	
-	rows, err := config.DB.Query(context.Background(), `
-		WITH numbered_courses AS (
-			SELECT id, title, description, level, duration, instructor,
-				   ROW_NUMBER() OVER (ORDER BY id) as row_num
-			FROM courses
-		)
-		SELECT id, title, description, level, duration, instructor
-		FROM numbered_courses
-		WHERE row_num > $1
-		ORDER BY row_num
-		LIMIT 5
-	`, offset)
-	
+	slog.Debug("Recommended courses offset", "offset", offset)
+
+	page, err := h.Store.Courses().Page(r.Context(), offset, 5)
 	if err != nil {
 		log.Printf("Error fetching courses with offset: %v", err)
-		
-		rows, err = config.DB.Query(context.Background(), `
-			SELECT id, title, description, level, duration, instructor
-			FROM courses
-			LIMIT 5
-		`)
-		
-		if err != nil {
-			log.Printf("Error fetching courses with fallback query: %v", err)
-			http.Error(w, "Failed to fetch courses", http.StatusInternalServerError)
-			return
-		}
-	}
-	defer rows.Close()
-	
-	var courses []map[string]interface{}
-	
-	for rows.Next() {
-		var id int
-		var title, description, level, duration, instructor string
-		
-		err := rows.Scan(&id, &title, &description, &level, &duration, &instructor)
-		if err != nil {
-			log.Printf("Error scanning course row: %v", err)
-			continue
-		}
-		
-		log.Printf("Found course: ID=%d, Title=%s", id, title)
-		
-		courses = append(courses, map[string]interface{}{
-			"id":          id,
-			"title":       title,
-			"description": description,
-			"level":       level,
-			"duration":    duration,
-			"instructor":  instructor,
-		})
+		http.Error(w, "Failed to fetch courses", http.StatusInternalServerError)
+		return
 	}
-	
-	if len(courses) < 5 && totalCourses >= 5 {
+
+	if len(page) < 5 && totalCourses >= 5 {
 		log.Printf("Not enough courses from first query, fetching additional courses from beginning")
-		
-		additionalRows, err := config.DB.Query(context.Background(), `
-			SELECT id, title, description, level, duration, instructor
-			FROM courses
-			ORDER BY id
-			LIMIT $1
-		`, 5 - len(courses))
-		
+
+		additional, err := h.Store.Courses().Page(r.Context(), 0, 5-len(page))
 		if err != nil {
 			log.Printf("Error fetching additional courses: %v", err)
-		} else {
-			defer additionalRows.Close()
-			
-			for additionalRows.Next() {
-				var id int
-				var title, description, level, duration, instructor string
-				
-				err := additionalRows.Scan(&id, &title, &description, &level, &duration, &instructor)
-				if err != nil {
-					log.Printf("Error scanning additional course row: %v", err)
-					continue
-				}
-				
-				isDuplicate := false
-				for _, existingCourse := range courses {
-					if existingCourse["id"] == id {
-						isDuplicate = true
-						break
-					}
-				}
-				
-				if !isDuplicate {
-					log.Printf("Adding additional course: ID=%d, Title=%s", id, title)
-					
-					courses = append(courses, map[string]interface{}{
-						"id":          id,
-						"title":       title,
-						"description": description,
-						"level":       level,
-						"duration":    duration,
-						"instructor":  instructor,
-					})
-					
-					if len(courses) >= 5 {
-						break
-					}
+		}
+		for _, c := range additional {
+			isDuplicate := false
+			for _, existing := range page {
+				if existing.ID == c.ID {
+					isDuplicate = true
+					break
 				}
 			}
+			if !isDuplicate {
+				page = append(page, c)
+			}
 		}
 	}
-	
+
+	var courses []map[string]interface{}
+	for _, c := range page {
+		slog.Debug("Recommending course", "id", c.ID, "title", c.Title)
+
+		courses = append(courses, map[string]interface{}{
+			"id":          c.ID,
+			"title":       c.Title,
+			"description": c.Description,
+			"level":       c.Level,
+			"duration":    c.Duration,
+			"instructor":  c.Instructor,
+		})
+	}
+
 	if len(courses) == 0 {
 		log.Printf("No courses found after all queries")
 		http.Error(w, "No courses available", http.StatusNotFound)
@@ -435,269 +252,199 @@ func GetRecommendedCourses(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(courses)
 }
 
-func SyncCompletedCourses(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	
+func (h *UserHandler) SyncCompletedCourses(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Authorization header required", http.StatusUnauthorized)
-		return
-	}
-	
-	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
-	claims, err := utils.VerifyToken(tokenString)
-	if err != nil {
-		log.Printf("Invalid token: %v", err)
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-	
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		log.Println("Invalid user ID in token claims")
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-	userID := int(userIDFloat)
-	
-	tx, err := config.DB.Begin(context.Background())
-	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback(context.Background())
-	
+
+	userID := middleware.MustPrincipal(r.Context()).ID
+
 	var completedCourses int
-	err = tx.QueryRow(context.Background(),
-		`SELECT COUNT(*) FROM user_courses 
-		WHERE user_id = $1 AND completed = true`,
-		userID).Scan(&completedCourses)
-	
-	if err != nil {
-		log.Printf("Error counting completed courses: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	
-	log.Printf("User %d has completed %d courses", userID, completedCourses)
-	
-	_, err = tx.Exec(context.Background(),
-		`UPDATE users SET completed_courses = $1
-		WHERE id = $2`,
-		completedCourses, userID)
-	
+	err := h.Store.WithTx(r.Context(), func(store repository.Store) error {
+		var err error
+		completedCourses, err = store.Enrollments().CountCompleted(r.Context(), userID)
+		if err != nil {
+			return fmt.Errorf("counting completed courses: %w", err)
+		}
+
+		log.Printf("User %d has completed %d courses", userID, completedCourses)
+
+		return store.Users().SetCompletedCourses(r.Context(), userID, completedCourses)
+	})
 	if err != nil {
 		log.Printf("Error updating completed_courses: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	
-	if err := tx.Commit(context.Background()); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	
+
 	log.Printf("Successfully updated completed_courses for user %d to %d", userID, completedCourses)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
+		"success":           true,
 		"completed_courses": completedCourses,
 	})
 }
 
-func SyncUserProgress(w http.ResponseWriter, r *http.Request) {
-
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-		http.Error(w, "Authorization token required", http.StatusUnauthorized)
-		return
-	}
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-	
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-	
-	if err != nil {
-		log.Printf("Error parsing token: %v", err)
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-	
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		log.Println("Invalid user ID in token claims")
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-	userID := int(userIDFloat)
+func (h *UserHandler) SyncUserProgress(w http.ResponseWriter, r *http.Request) {
 
-	var totalModules, completedModules int
-
-	err = config.DB.QueryRow(context.Background(), 
-		"SELECT COUNT(*) FROM course_modules").Scan(&totalModules)
-	
-	if err != nil {
-		log.Printf("Error counting total modules: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
+	userID := middleware.MustPrincipal(r.Context()).ID
 
-	err = config.DB.QueryRow(context.Background(), 
-		"SELECT COUNT(*) FROM completed_modules WHERE user_id = $1", userID).Scan(&completedModules)
-	
+	globalProgress, completedModules, totalModules, err := getGlobalProgress(r.Context(), h.Store.Enrollments(), userID)
 	if err != nil {
-		log.Printf("Error counting completed modules: %v", err)
+		log.Printf("Error computing global progress: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	var globalProgress int
-	
-	if totalModules > 0 {
-		globalProgress = (completedModules * 100) / totalModules
-	}
-	
-	log.Printf("User %d global progress: %d%% (%d/%d modules completed across all courses)", 
+	log.Printf("User %d global progress: %d%% (%d/%d modules completed across enrolled courses)",
 		userID, globalProgress, completedModules, totalModules)
 
-	var completedCourses int
-	err = config.DB.QueryRow(context.Background(),
-		`SELECT COUNT(*) FROM user_courses 
-		WHERE user_id = $1 AND completed = true`,
-		userID).Scan(&completedCourses)
-	
+	completedCourses, err := h.Store.Enrollments().CountCompleted(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error counting completed courses: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	_, err = config.DB.Exec(context.Background(),
-		"UPDATE users SET progress = $1, completed_courses = $2 WHERE id = $3", 
-		globalProgress, completedCourses, userID)
-	
+	err = h.Store.Users().SetProgress(r.Context(), userID, globalProgress, completedCourses)
 	if err != nil {
 		log.Printf("Error updating user progress and completed courses: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	} else {
-		log.Printf("Updated global progress for user %d to %d%% and completed courses to %d", 
+		log.Printf("Updated global progress for user %d to %d%% and completed courses to %d",
 			userID, globalProgress, completedCourses)
 	}
-	
+
 	response := map[string]interface{}{
 		"progress":          globalProgress,
 		"completed_courses": completedCourses,
 		"message":           "User progress synchronized successfully",
 	}
-	
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleUserOperations(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+func (h *UserHandler) HandleUserOperations(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	rest := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"), "/"), "/")
+	if rest[0] == "lockouts" {
+		h.listLoginLockouts(w, r)
 		return
 	}
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	
-	claims, err := utils.VerifyToken(tokenStr)
+
+	userID, err := strconv.Atoi(rest[0])
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	
-	role, ok := claims["role"].(string)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
-	
-	urlParts := strings.Split(r.URL.Path, "/")
-	if len(urlParts) < 4 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+
+	if len(rest) > 2 {
+		writeJSONError(w, http.StatusNotFound, "Not found")
 		return
 	}
-	
-	userID, err := strconv.Atoi(urlParts[len(urlParts)-1])
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	if len(rest) == 2 {
+		if rest[1] == "lockout" {
+			h.handleUserLockout(w, r, userID)
+		} else {
+			h.handleUserAction(w, r, userID, rest[1])
+		}
 		return
 	}
-	
+
 	switch r.Method {
+	case "GET":
+		h.writeAdminUser(w, r, http.StatusOK, userID)
+
 	case "PUT":
 		var req struct {
 			Username string `json:"username"`
 		}
-		
+
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid request body", nil)
+			return
+		}
+		if msg := checkUsername(&req.Username); msg != "" {
+			writeAPIError(w, http.StatusUnprocessableEntity, errCodeValidation, "Invalid user",
+				map[string]interface{}{"username": msg})
+			return
+		}
+
+		err := h.Store.WithTx(r.Context(), func(store repository.Store) error {
+			taken, err := store.Users().UsernameTaken(r.Context(), req.Username, userID)
+			if err != nil {
+				return fmt.Errorf("checking username: %w", err)
+			}
+			if taken {
+				writeAPIError(w, http.StatusConflict, errCodeUsernameTaken, "Username sudah terdaftar", nil)
+				return errResponseWritten
+			}
+
+			previous, err := store.Users().Rename(r.Context(), userID, req.Username)
+			if writeUniqueViolation(w, err) {
+				return errResponseWritten
+			}
+			if errors.Is(err, repository.ErrNotFound) {
+				writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found",
+					map[string]interface{}{"userId": userID})
+				return errResponseWritten
+			}
+			if err != nil {
+				return err
+			}
+			return recordAudit(r.Context(), store.Audit(), r, auditEvent{
+				Action: "user.rename", TargetType: "user", TargetID: userID,
+				Before: map[string]string{"username": previous},
+				After:  map[string]string{"username": req.Username},
+			})
+		})
+		if errors.Is(err, errResponseWritten) {
 			return
 		}
-		
-		_, err = config.DB.Exec(context.Background(),
-			"UPDATE users SET username = $1 WHERE id = $2",
-			req.Username, userID)
-		
 		if err != nil {
 			log.Printf("Error updating user: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
-		
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "User updated successfully"})
-		
+
 	case "DELETE":
-		tx, err := config.DB.Begin(context.Background())
-		if err != nil {
-			log.Printf("Error starting transaction: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Database error"})
+		if userID == middleware.MustPrincipal(r.Context()).ID {
+			writeAPIError(w, http.StatusConflict, errCodeSelfModification,
+				"Admins cannot delete their own account here", nil)
 			return
 		}
-		defer tx.Rollback(context.Background())
-		
-		tables := []string{
-			"completed_modules",
-			"user_courses",
-			"user_bookmarks", 
-			"user_activities",
-		}
-		
-		for _, table := range tables {
-			_, err = tx.Exec(context.Background(), 
-				fmt.Sprintf("DELETE FROM %s WHERE user_id = $1", table), 
-				userID)
+
+		err := h.Store.WithTx(r.Context(), func(store repository.Store) error {
+			before, err := loadAdminUser(r.Context(), store.Users(), userID)
+			if errors.Is(err, repository.ErrNotFound) {
+				writeAPIError(w, http.StatusNotFound, errCodeUserNotFound, "User not found",
+					map[string]interface{}{"userId": userID})
+				return errResponseWritten
+			}
 			if err != nil {
-				log.Printf("Error deleting from %s: %v", table, err)
-		
+				return err
 			}
+			if err := store.Users().Delete(r.Context(), userID); err != nil {
+				return err
+			}
+			return recordAudit(r.Context(), store.Audit(), r, auditEvent{
+				Action: "user.delete", TargetType: "user", TargetID: userID, Before: before,
+			})
+		})
+		if errors.Is(err, errResponseWritten) {
+			return
 		}
-		
-		_, err = tx.Exec(context.Background(),
-			"DELETE FROM users WHERE id = $1", userID)
-		
 		if err != nil {
 			log.Printf("Error deleting user: %v", err)
 			w.Header().Set("Content-Type", "application/json")
@@ -705,18 +452,10 @@ func HandleUserOperations(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(map[string]string{"message": "Failed to delete user. The user may have associated data."})
 			return
 		}
-		
-		if err = tx.Commit(context.Background()); err != nil {
-			log.Printf("Error committing transaction: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Database error"})
-			return
-		}
-		
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
-		
+
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
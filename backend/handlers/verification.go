@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"backend/mailer"
+	"backend/repository"
+	"backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Verification links carry a signed token (see utils.GenerateEmailVerificationToken)
+// rather than a stored secret; it names both the user and the address, so a
+// link stops working once the account's email changes.
+
+const resendVerificationMessage = "If the account exists and is not verified yet, a new link has been sent"
+
+func sendVerificationEmail(ctx context.Context, userID int, username, email string) error {
+	token, err := utils.GenerateEmailVerificationToken(userID, email)
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL("/verify-email", url.Values{"token": {token}})
+	return mailer.Default().Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: "Hi " + username + ",\n\n" +
+			"Please confirm your email address by opening the link below. It expires in " +
+			utils.EmailVerificationTTL.String() + ".\n\n" +
+			link + "\n",
+	})
+}
+
+// requireVerifiedUser writes a 403 and returns false when the user has not
+// confirmed their current email address.
+func requireVerifiedUser(ctx context.Context, w http.ResponseWriter, users repository.UserRepository, userID int) bool {
+	verified, err := users.EmailVerified(ctx, userID)
+	if err != nil {
+		log.Printf("Error checking email verification for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	if !verified {
+		writeAPIError(w, http.StatusForbidden, errCodeEmailNotVerified,
+			"Please verify your email address first", nil)
+		return false
+	}
+	return true
+}
+
+// VerifyEmail confirms the address named in a verification token.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "token is required", nil)
+		return
+	}
+
+	userID, email, err := utils.VerifyEmailVerificationToken(req.Token)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		writeAPIError(w, http.StatusBadRequest, errCodeVerifyExpired, "Verification link has expired", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Rejected email verification token: %v", err)
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidVerify, "Verification link is invalid", nil)
+		return
+	}
+
+	alreadyVerified, err := h.Store.Users().VerifyEmail(r.Context(), userID, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// The account is gone or its email changed since the link was sent.
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidVerify, "Verification link is invalid", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if !alreadyVerified {
+		log.Printf("User %d verified their email", userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Email verified",
+		"verified": true,
+	})
+}
+
+// ResendVerification sends a fresh link to an unverified account. Like
+// ForgotPassword it answers the same way, and as quickly, for unknown
+// addresses.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidRequest, "email is required", nil)
+		return
+	}
+
+	address := strings.TrimSpace(req.Email)
+	if !allowMailRequest(w, r, h.Store.Throttles(), address) {
+		return
+	}
+	inBackground(r, "resending verification email", func(ctx context.Context) error {
+		user, err := h.Store.Users().FindByEmail(ctx, address)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && user.EmailVerifiedAt != nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return sendVerificationEmail(ctx, user.ID, user.Username, user.Email)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": resendVerificationMessage})
+}
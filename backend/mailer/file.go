@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// FileMailer is a stand-in for development and tests. With an empty Dir it
+// writes each message to the server log; otherwise every message becomes a
+// file in Dir so links can be opened without a mail server.
+type FileMailer struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	text := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		log.Printf("Mail (not sent):\n%s", text)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.txt", time.Now().Format("20060102T150405.000000000"),
+		unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s written to %s", msg.To, path)
+	return nil
+}
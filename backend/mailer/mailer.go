@@ -0,0 +1,103 @@
+// Package mailer sends transactional email such as password reset links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures a mailer. Driver is one of:
+//
+//	smtp  sends through SMTPHost:SMTPPort (default 587) from From
+//	file  writes each message to a file in Dir (default "mail")
+//	log   writes messages to the server log (the default)
+type Config struct {
+	Driver       string
+	Dir          string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Validate reports settings New would reject.
+func (c Config) Validate() error {
+	switch c.Driver {
+	case "smtp":
+		if c.SMTPHost == "" || c.From == "" {
+			return fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST and MAIL_FROM")
+		}
+	case "file", "", "log":
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", c.Driver)
+	}
+	return nil
+}
+
+// New builds the mailer c selects.
+func New(c Config) (Mailer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Driver {
+	case "smtp":
+		port := c.SMTPPort
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     c.SMTPHost,
+			Port:     port,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.From,
+		}, nil
+	case "file":
+		dir := c.Dir
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir}, nil
+	default:
+		return FileMailer{}, nil
+	}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultMailer Mailer = FileMailer{}
+)
+
+// Init replaces the process-wide mailer, which logs messages until main
+// configures it.
+func Init(c Config) error {
+	m, err := New(c)
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defaultMailer = m
+	defaultMu.Unlock()
+	return nil
+}
+
+// Default returns the process-wide mailer.
+func Default() Mailer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultMailer
+}
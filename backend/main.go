@@ -1,68 +1,241 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"backend/config"
 	"backend/handlers"
-
-	"github.com/joho/godotenv"
+	"backend/mailer"
+	"backend/middleware"
+	"backend/migrate"
+	"backend/repository"
+	"backend/utils"
 )
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// runMigrate implements "migrate up", "migrate down [n]" and
+// "migrate status". down reverts one migration unless n says otherwise.
+func runMigrate(args []string) error {
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		n, err := migrate.Up(ctx, config.DB)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migrations", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down takes a positive number of steps, got %q", args[1])
+			}
+			steps = n
+		}
+		n, err := migrate.Down(ctx, config.DB, steps)
+		if err != nil {
+			return err
 		}
-		
-		next.ServeHTTP(w, r)
-	})
+		log.Printf("Reverted %d migrations", n)
+	case "status":
+		statuses, err := migrate.List(ctx, config.DB)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down [n] or status)", command)
+	}
+	return nil
 }
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Tidak ada file .env atau gagal memproses file .env")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	config.App = cfg
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})))
+	// SetDefault also routes the log package through the handler at info
+	// level, which LOG_LEVEL=warn would silence along with every error
+	// logged with log.Printf. Keep that output unfiltered.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		config.ConnectDB(cfg.DB)
+		err := runMigrate(os.Args[2:])
+		config.DB.Close()
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if err := serve(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs the API server until it fails or receives SIGINT or SIGTERM.
+// It returns rather than exiting so the deferred cleanup, including closing
+// the database pool, always runs.
+func serve(cfg *config.Config) error {
+	utils.AccessTokenTTL = cfg.AccessTokenTTL
+	utils.RefreshTokenTTL = cfg.RefreshTokenTTL
+	utils.PasswordResetTTL = cfg.PasswordResetTTL
+	utils.EmailVerificationTTL = cfg.EmailVerificationTTL
+	if err := utils.InitTokenService(cfg.JWT); err != nil {
+		return fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+	if err := mailer.Init(cfg.Mail); err != nil {
+		return fmt.Errorf("failed to configure mailer: %w", err)
 	}
+	if cfg.RequireAdmin2FA {
+		middleware.RequireMFAFor(middleware.RoleAdmin)
+	}
+
+	config.ConnectDB(cfg.DB)
+	defer func() {
+		config.DB.Close()
+		log.Println("Database pool closed")
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if os.Getenv("DATABASE_URL") == "" {
-		log.Fatal("DATABASE_URL is not set")
+	if cfg.MigrateOnStart {
+		if _, err := migrate.Up(ctx, config.DB); err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	} else if pending, err := migrate.Pending(ctx, config.DB); err != nil {
+		log.Printf("Could not check for pending migrations: %v", err)
+	} else if len(pending) > 0 {
+		log.Printf("Warning: %d migrations are pending; run \"backend migrate up\"", len(pending))
 	}
 
-	config.ConnectDB()
-	defer config.DB.Close()
+	// route wraps h so that only authenticated callers holding perm reach it.
+	route := func(perm middleware.Permission, h http.HandlerFunc) http.Handler {
+		return middleware.Authenticate(middleware.RequirePermission(perm)(h))
+	}
+
+	store := repository.NewPgxStore(config.DB)
+	auth := &handlers.AuthHandler{Store: store}
+	progress := &handlers.ProgressHandler{Store: store}
+	bookmarks := &handlers.BookmarkHandler{Bookmarks: store.Bookmarks()}
+	activities := &handlers.ActivityHandler{Courses: store.Courses(), Activities: store.Activities()}
+	courses := &handlers.CourseHandler{Store: store}
+	users := &handlers.UserHandler{Store: store}
+	audit := &handlers.AuditHandler{Audit: store.Audit()}
+	maintenance := &handlers.MaintenanceHandler{Store: store}
+	templates := &handlers.TemplateHandler{Store: store}
+	health := &handlers.HealthHandler{Pool: config.DB}
+
+	handlers.StartCoursePurger(ctx, store, cfg.CourseRetention, cfg.CoursePurgeInterval)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/register", handlers.Register)
-	mux.HandleFunc("/api/login", handlers.Login)
-	mux.HandleFunc("/api/courses", handlers.GetCourses)
-	mux.HandleFunc("/api/courses/search", handlers.SearchCourses)
-	mux.HandleFunc("/api/bookmarks", handlers.GetBookmarks)
-	mux.HandleFunc("/api/bookmarks/toggle", handlers.ToggleBookmark)
-	mux.HandleFunc("/api/user/profile", handlers.GetUserProfile)
-	mux.HandleFunc("/api/user/activities", handlers.GetUserActivities)
-	mux.HandleFunc("/api/user/recommended-courses", handlers.GetRecommendedCourses)
-	mux.HandleFunc("/api/courses/progress", handlers.UpdateProgress)
-	mux.HandleFunc("/api/courses/", handlers.GetCourseById)
-	mux.HandleFunc("/api/user/record-activity", handlers.RecordActivity)
-	mux.HandleFunc("/api/admin/cleanup-modules", handlers.CleanupDuplicateModules)
-	mux.HandleFunc("/api/user/sync-completed-courses", handlers.SyncCompletedCourses)
-	mux.HandleFunc("/api/user/sync-progress", handlers.SyncUserProgress)
-	mux.HandleFunc("/api/admin/users", handlers.GetAllUsers)
-	mux.HandleFunc("/api/admin/users/", handlers.HandleUserOperations)
-	mux.HandleFunc("/api/admin/courses", handlers.AdminCourseHandler)
-	
-	mux.HandleFunc("/api/admin/courses/", handlers.AdminCourseByID)
-	
-	handler := corsMiddleware(mux)
-
-	log.Println("Server running at :8000")
-	log.Fatal(http.ListenAndServe(":8000", handler))
+	mux.HandleFunc("/healthz", health.Healthz)
+	mux.HandleFunc("/readyz", health.Readyz)
+	mux.HandleFunc("/api/register", auth.Register)
+	mux.HandleFunc("/api/login", auth.Login)
+	mux.HandleFunc("/api/login/2fa", auth.LoginTwoFactor)
+	mux.HandleFunc("/api/token/refresh", auth.RefreshToken)
+	mux.HandleFunc("/api/logout", auth.Logout)
+	mux.HandleFunc("/api/password/forgot", auth.ForgotPassword)
+	mux.HandleFunc("/api/password/reset", auth.ResetPassword)
+	mux.HandleFunc("/api/email/verify", auth.VerifyEmail)
+	mux.HandleFunc("/api/email/resend-verification", auth.ResendVerification)
+	mux.Handle("/api/logout-all", route(middleware.PermLearn, auth.LogoutAll))
+	mux.Handle("/api/2fa", route(middleware.PermLearn, auth.TwoFactor))
+	mux.Handle("/api/2fa/", route(middleware.PermLearn, auth.TwoFactor))
+	mux.HandleFunc("/.well-known/jwks.json", handlers.JWKS)
+	mux.Handle("/api/courses", route(middleware.PermCourseRead, courses.GetCourses))
+	mux.Handle("/api/courses/search", route(middleware.PermCourseRead, courses.SearchCourses))
+	mux.Handle("/api/bookmarks", route(middleware.PermLearn, bookmarks.GetBookmarks))
+	mux.Handle("/api/bookmarks/toggle", route(middleware.PermLearn, bookmarks.ToggleBookmark))
+	mux.Handle("/api/user/profile", route(middleware.PermLearn, users.GetUserProfile))
+	mux.Handle("/api/user/password", route(middleware.PermLearn, users.ChangePassword))
+	mux.Handle("/api/user", route(middleware.PermLearn, users.DeleteAccount))
+	mux.Handle("/api/user/activities", route(middleware.PermLearn, activities.GetUserActivities))
+	mux.Handle("/api/user/recommended-courses", route(middleware.PermLearn, users.GetRecommendedCourses))
+	mux.Handle("/api/courses/progress", route(middleware.PermLearn, progress.UpdateProgress))
+	mux.Handle("/api/courses/", route(middleware.PermCourseRead, courses.GetCourseById))
+	mux.Handle("/api/user/record-activity", route(middleware.PermLearn, activities.RecordActivity))
+	mux.Handle("/api/admin/cleanup-modules", route(middleware.PermMaintenanceRun, maintenance.CleanupDuplicateModules))
+	mux.Handle("/api/admin/maintenance/runs", route(middleware.PermMaintenanceRun, maintenance.MaintenanceRuns))
+	mux.Handle("/api/admin/maintenance/runs/", route(middleware.PermMaintenanceRun, maintenance.MaintenanceRuns))
+	mux.Handle("/api/user/sync-completed-courses", route(middleware.PermLearn, users.SyncCompletedCourses))
+	mux.Handle("/api/user/sync-progress", route(middleware.PermLearn, users.SyncUserProgress))
+	mux.Handle("/api/admin/users", route(middleware.PermUserManage, users.GetAllUsers))
+	mux.Handle("/api/admin/users/", route(middleware.PermUserManage, users.HandleUserOperations))
+	mux.Handle("/api/admin/courses", route(middleware.PermCourseWrite, courses.AdminCourseHandler))
+
+	mux.Handle("/api/admin/courses/", route(middleware.PermCourseWrite, courses.AdminCourseByID))
+	mux.Handle("/api/admin/course-templates", route(middleware.PermTemplateWrite, templates.CourseTemplates))
+	mux.Handle("/api/admin/course-templates/", route(middleware.PermTemplateWrite, templates.CourseTemplateByID))
+	mux.Handle("/api/admin/modules/auto-generated", route(middleware.PermReportRead, courses.ListAutoGeneratedModules))
+	mux.Handle("/api/admin/reports/dangling-progress", route(middleware.PermReportRead, progress.DanglingProgressReport))
+	mux.Handle("/api/admin/audit", route(middleware.PermAuditRead, audit.AuditLog))
+
+	handler := middleware.RequestID(middleware.CORS(cfg.CORSOrigins)(mux))
+
+	// Requests still running when the shutdown timeout expires are
+	// cancelled so their queries release the pool before it is closed.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	srv := &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      handler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		BaseContext:  func(net.Listener) context.Context { return requestCtx },
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server running at %s", cfg.ListenAddr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+	handlers.ShuttingDown()
+
+	log.Printf("Shutting down; waiting up to %s for in-flight requests", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown did not finish cleanly: %w", err)
+	}
+	if err := handlers.WaitBackground(shutdownCtx); err != nil {
+		return fmt.Errorf("background work did not finish: %w", err)
+	}
+	log.Println("Server stopped")
+	return nil
 }
@@ -1,60 +1,111 @@
 package middleware
 
 import (
-	"backend/utils"
 	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+
+	"backend/config"
+	"backend/utils"
+
+	"github.com/jackc/pgx/v5"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.Method == "OPTIONS" {
-            w.Header().Set("Access-Control-Allow-Origin", "*")
-            w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-            w.WriteHeader(http.StatusOK)
-            return
-        }
-
-        authHeader := r.Header.Get("Authorization")
-        // ...existing code...
-
-        if authHeader == "" {
-            // ...existing code...
-            http.Error(w, "Unauthorized", http.StatusUnauthorized)
-            return
-        }
-
-        if !strings.HasPrefix(authHeader, "Bearer ") {
-            // ...existing code...
-            http.Error(w, "Invalid token format", http.StatusUnauthorized)
-            return
-        }
-
-        tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-        if tokenString == "" {
-            // ...existing code...
-            http.Error(w, "Empty token", http.StatusUnauthorized)
-            return
-        }
-
-        claims, err := utils.VerifyToken(tokenString)
-        if err != nil {
-            // ...existing code...
-            http.Error(w, "Invalid token", http.StatusUnauthorized)
-            return
-        }
-
-        userID, ok := claims["user_id"].(float64)
-        if !ok {
-            // ...existing code...
-            http.Error(w, "Invalid token", http.StatusUnauthorized)
-            return
-        }
-
-        ctx := context.WithValue(r.Context(), "userID", userID)
-        
-        next.ServeHTTP(w, r.WithContext(ctx))
-    })
-}
\ No newline at end of file
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID       int
+	Role     string
+	Username string
+	TokenID  string
+	// MFA is set when the session was established with a second factor.
+	MFA bool
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// MustPrincipal returns the principal of a request that went through
+// Authenticate. Calling it on an unauthenticated route is a wiring bug.
+func MustPrincipal(ctx context.Context) *Principal {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		panic("middleware: no principal in context; is the route wrapped in Authenticate?")
+	}
+	return p
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
+
+// Authenticate verifies the bearer token, checks that the account still
+// exists and is not suspended, and stores the caller's Principal in the
+// request context. Preflight requests pass through untouched.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Missing bearer token")
+			return
+		}
+
+		claims, err := utils.VerifyToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			log.Printf("Unauthorized: Invalid token: %v", err)
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid token")
+			return
+		}
+
+		userID, ok := claims["user_id"].(float64)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid token")
+			return
+		}
+
+		p := &Principal{ID: int(userID)}
+		p.Username, _ = claims["username"].(string)
+		p.TokenID, _ = claims["jti"].(string)
+		p.MFA, _ = claims["mfa"].(bool)
+
+		// The role is read from the database rather than the token so that
+		// role changes, suspensions and deletions apply immediately.
+		var suspended bool
+		err = config.DB.QueryRow(r.Context(),
+			"SELECT role, suspended_at IS NOT NULL FROM users WHERE id = $1", p.ID).Scan(&p.Role, &suspended)
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Account no longer exists")
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading account %d: %v", p.ID, err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "Server error")
+			return
+		}
+		if suspended {
+			writeError(w, http.StatusForbidden, "account_suspended", "This account has been suspended")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
@@ -1,26 +0,0 @@
-package middleware
-
-import (
-	"backend/utils"
-	"net/http"
-	"strings"
-)
-
-func JWTAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		
-		_, err := utils.VerifyToken(tokenStr)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		
-		next.ServeHTTP(w, r)
-	})
-}
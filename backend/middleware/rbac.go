@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+const (
+	RoleLearner       = "learner"
+	RoleInstructor    = "instructor"
+	RoleContentEditor = "content-editor"
+	RoleAdmin         = "admin"
+)
+
+// Permission names a single capability granted by a role.
+type Permission string
+
+const (
+	// PermCourseRead covers browsing the catalogue.
+	PermCourseRead Permission = "course:read"
+	// PermLearn covers a user's own enrollments, progress, bookmarks and profile.
+	PermLearn Permission = "learn"
+	// PermCourseWrite allows creating courses and editing the ones the caller owns.
+	PermCourseWrite Permission = "course:write"
+	// PermCourseWriteAny lifts the ownership restriction of PermCourseWrite.
+	PermCourseWriteAny Permission = "course:write:any"
+	PermTemplateWrite  Permission = "template:write"
+	PermReportRead     Permission = "report:read"
+	PermUserManage     Permission = "user:manage"
+	PermMaintenanceRun Permission = "maintenance:run"
+	PermAuditRead      Permission = "audit:read"
+)
+
+var learnerPermissions = []Permission{PermCourseRead, PermLearn}
+
+var rolePermissions = map[string][]Permission{
+	RoleLearner:    learnerPermissions,
+	RoleInstructor: append([]Permission{PermCourseWrite}, learnerPermissions...),
+	RoleContentEditor: append([]Permission{
+		PermCourseWrite, PermCourseWriteAny, PermTemplateWrite, PermReportRead,
+	}, learnerPermissions...),
+	RoleAdmin: append([]Permission{
+		PermCourseWrite, PermCourseWriteAny, PermTemplateWrite, PermReportRead,
+		PermUserManage, PermMaintenanceRun, PermAuditRead,
+	}, learnerPermissions...),
+	// "user" is the role name accounts were created with before roles were
+	// split up. Migration 0002 renames it to learner and Authenticate reads
+	// the role from the database on every request, so this only covers a
+	// database that has not been migrated yet.
+	"user": learnerPermissions,
+}
+
+// mfaRequiredRoles holds the roles that must use two-factor authentication
+// for anything beyond learner permissions. It is configured once at startup.
+var mfaRequiredRoles = map[string]bool{}
+
+// RequireMFAFor makes two-factor authentication mandatory for roles.
+func RequireMFAFor(roles ...string) {
+	for _, role := range roles {
+		mfaRequiredRoles[role] = true
+	}
+}
+
+// MFARequired reports whether role must use two-factor authentication.
+func MFARequired(role string) bool {
+	return mfaRequiredRoles[role]
+}
+
+// ValidRole reports whether role is one that can be assigned to an account.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleLearner, RoleInstructor, RoleContentEditor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role string, perm Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the principal's role grants perm.
+func (p *Principal) Can(perm Permission) bool {
+	return HasPermission(p.Role, perm)
+}
+
+// RequirePermission rejects authenticated callers whose role does not grant
+// perm. It must run after Authenticate.
+func RequirePermission(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+			if !p.Can(perm) {
+				log.Printf("User %d with role %q lacks %s for %s", p.ID, p.Role, perm, r.URL.Path)
+				writeError(w, http.StatusForbidden, "forbidden", "Forbidden: missing permission "+string(perm))
+				return
+			}
+			// Learner permissions stay available so the user can still
+			// reach the two-factor setup endpoints.
+			if MFARequired(p.Role) && !p.MFA && !HasPermission(RoleLearner, perm) {
+				writeError(w, http.StatusForbidden, "mfa_required", "Two-factor authentication is required for this account")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadOrderAndPairs(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "baseline" {
+		t.Errorf("first migration = %04d_%s, want 0001_baseline", migrations[0].Version, migrations[0].Name)
+	}
+
+	for i, m := range migrations {
+		if want := int64(i + 1); m.Version != want {
+			t.Errorf("migration %d has version %d, want %d (versions must be contiguous and ascending)", i, m.Version, want)
+		}
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %04d_%s has an empty up file", m.Version, m.Name)
+		}
+		// Only the baseline may be irreversible.
+		if m.Version == 1 {
+			if m.Down != "" {
+				t.Error("the baseline migration must not have a down file")
+			}
+		} else if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestToRevert(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "baseline", Up: "up"},
+		{Version: 2, Name: "auth", Up: "up", Down: "down"},
+		{Version: 3, Name: "operations", Up: "up", Down: "down"},
+		{Version: 4, Name: "pending", Up: "up", Down: "down"},
+	}
+	now := time.Now()
+	applied := map[int64]time.Time{1: now, 2: now, 3: now}
+
+	tests := []struct {
+		name    string
+		steps   int
+		want    []int64
+		wantErr bool
+	}{
+		{"one step", 1, []int64{3}, false},
+		{"down to the baseline", 2, []int64{3, 2}, false},
+		{"past the baseline", 3, nil, true},
+		{"far past the baseline", 10, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toRevert(migrations, applied, tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toRevert error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("toRevert = %d migrations, want %v", len(got), tt.want)
+			}
+			for i, m := range got {
+				if m.Version != tt.want[i] {
+					t.Errorf("toRevert[%d] = %d, want %d", i, m.Version, tt.want[i])
+				}
+			}
+		})
+	}
+}
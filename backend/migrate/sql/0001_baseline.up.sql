@@ -0,0 +1,136 @@
+-- Core learning tables. Every statement tolerates objects that already
+-- exist so databases created by the old runtime schema code adopt this
+-- migration without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(255) NOT NULL UNIQUE,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	password VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL DEFAULT 'learner',
+	status VARCHAR(255),
+	progress INTEGER NOT NULL DEFAULT 0,
+	completed_courses INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS courses (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL,
+	level VARCHAR(50) DEFAULT 'beginner',
+	duration VARCHAR(100),
+	instructor VARCHAR(255),
+	video_url VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE courses
+	ADD COLUMN IF NOT EXISTS owner_id INTEGER,
+	ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS archived_by INTEGER;
+
+CREATE INDEX IF NOT EXISTS courses_owner_id_idx ON courses (owner_id);
+CREATE INDEX IF NOT EXISTS courses_archived_at_idx ON courses (archived_at) WHERE archived_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS course_modules (
+	id SERIAL PRIMARY KEY,
+	course_id INTEGER,
+	title VARCHAR(255) NOT NULL,
+	content TEXT,
+	description TEXT,
+	video_url VARCHAR(255),
+	module_order INTEGER DEFAULT 1,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS course_modules_course_id_idx ON course_modules (course_id, module_order);
+
+-- Flag the legacy filler once, when the column is introduced, so an admin
+-- who later clears the flag on a real module is not overruled. The filter
+-- matches the per-level defaults older versions of GetCourseById inserted
+-- and the stubs UpdateProgress created for unknown module IDs.
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'course_modules' AND column_name = 'auto_generated'
+	) THEN
+		ALTER TABLE course_modules ADD COLUMN auto_generated BOOLEAN NOT NULL DEFAULT false;
+		UPDATE course_modules SET auto_generated = true
+		WHERE description = 'Auto-generated module'
+			OR (video_url = 'https://www.youtube.com/embed/ur6I5m2nTvk' AND (
+				title LIKE 'Pengenalan %'
+				OR title LIKE 'Dasar-dasar %'
+				OR title LIKE 'Praktik %'
+				OR title IN ('Teknik Menengah', 'Proyek Menengah')
+				OR title LIKE 'Modul 1: Pengenalan %'
+				OR title IN ('Modul 2: Materi Utama', 'Modul 3: Latihan dan Evaluasi')
+			));
+	END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS user_courses (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	progress INTEGER DEFAULT 0,
+	completed BOOLEAN DEFAULT false,
+	enrolled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP,
+	UNIQUE (user_id, course_id)
+);
+
+ALTER TABLE user_courses
+	ADD COLUMN IF NOT EXISTS enrolled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active',
+	ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS dropped_at TIMESTAMP;
+
+UPDATE user_courses SET status = 'completed'
+WHERE completed IS TRUE AND status = 'active';
+
+CREATE INDEX IF NOT EXISTS user_courses_course_id_idx ON user_courses (course_id);
+
+CREATE TABLE IF NOT EXISTS completed_modules (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	module_id INTEGER NOT NULL,
+	completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, module_id)
+);
+
+CREATE INDEX IF NOT EXISTS completed_modules_course_id_idx ON completed_modules (course_id);
+
+CREATE TABLE IF NOT EXISTS user_bookmarks (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, course_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_activities (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	type VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_activities_user_id_idx ON user_activities (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS course_templates (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	level VARCHAR(50),
+	description TEXT NOT NULL DEFAULT '',
+	modules JSONB NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
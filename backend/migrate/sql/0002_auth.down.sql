@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+
+ALTER TABLE users
+	DROP COLUMN IF EXISTS email_verified_at,
+	DROP COLUMN IF EXISTS suspended_reason,
+	DROP COLUMN IF EXISTS suspended_at;
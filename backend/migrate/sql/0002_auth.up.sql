@@ -0,0 +1,82 @@
+-- Sessions, password resets, login throttling, two-factor authentication
+-- and account state.
+
+-- Roles were renamed when RBAC was introduced.
+UPDATE users SET role = 'learner' WHERE role = 'user';
+
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS suspended_reason TEXT;
+
+-- Accounts that predate verification keep working; only new registrations
+-- have to confirm their address.
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'users' AND column_name = 'email_verified_at'
+	) THEN
+		ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+		UPDATE users SET email_verified_at = NOW();
+	END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	family_id VARCHAR(64) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	revoke_reason VARCHAR(50),
+	user_agent TEXT,
+	ip VARCHAR(64)
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP,
+	ip VARCHAR(64)
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS login_throttles (
+	scope VARCHAR(10) NOT NULL,
+	key VARCHAR(255) NOT NULL,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMP,
+	locked_until TIMESTAMP,
+	PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS login_throttles_locked_until_idx ON login_throttles (locked_until);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INTEGER PRIMARY KEY,
+	secret VARCHAR(64) NOT NULL,
+	enabled_at TIMESTAMP,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	code_hash CHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP,
+	UNIQUE (user_id, code_hash)
+);
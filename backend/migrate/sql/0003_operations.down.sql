@@ -0,0 +1,5 @@
+-- Dropping the table removes its triggers; the append-only rule only
+-- guards rows, not the table itself.
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_reject_change();
+DROP TABLE IF EXISTS maintenance_runs;
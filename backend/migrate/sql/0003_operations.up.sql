@@ -0,0 +1,49 @@
+-- Maintenance job history and the audit log.
+
+CREATE TABLE IF NOT EXISTS maintenance_runs (
+	id BIGSERIAL PRIMARY KEY,
+	job VARCHAR(50) NOT NULL,
+	actor_id INTEGER,
+	dry_run BOOLEAN NOT NULL DEFAULT false,
+	status VARCHAR(20) NOT NULL DEFAULT 'running',
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	finished_at TIMESTAMP,
+	summary JSONB,
+	error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS maintenance_runs_job_started_idx ON maintenance_runs (job, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	actor_id INTEGER,
+	actor_role VARCHAR(50),
+	action VARCHAR(100) NOT NULL,
+	target_type VARCHAR(50) NOT NULL,
+	target_id VARCHAR(100),
+	before JSONB,
+	after JSONB,
+	ip VARCHAR(64),
+	request_id VARCHAR(128)
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at_idx ON audit_log (occurred_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target_type, target_id);
+
+-- The audit log is append-only: rows can be inserted but never changed or
+-- removed, not even by the application's own database user.
+CREATE OR REPLACE FUNCTION audit_log_reject_change() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_reject_change();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_reject_change();
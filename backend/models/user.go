@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type User struct {
 	ID               int    `json:"id"`
 	Username         string `json:"username"`
@@ -9,15 +14,53 @@ type User struct {
 	Progress         int    `json:"progress"`
 	CompletedCourses int    `json:"completedCourses"`
 	Status           string `json:"status"`
+	EmailVerified    bool   `json:"emailVerified"`
+}
+
+// AdminUser is the account as administrators see it.
+type AdminUser struct {
+	ID               int
+	Email            string
+	Username         string
+	Role             string
+	Status           string
+	Progress         int
+	CompletedCourses int
+	EmailVerifiedAt  *time.Time
+	SuspendedAt      *time.Time
+	SuspendedReason  string
+	TwoFactorEnabled bool
 }
 
 type Course struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Level       string `json:"level"`
-	Duration    string `json:"duration"`
-	Instructor  string `json:"instructor"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Level       string     `json:"level"`
+	Duration    string     `json:"duration"`
+	Instructor  string     `json:"instructor"`
+	VideoUrl    string     `json:"videoUrl"`
+	OwnerID     *int       `json:"ownerId"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	ArchivedBy  *int       `json:"archivedBy,omitempty"`
+}
+
+// LearnerCourse is a course as one learner sees it: with their enrollment,
+// their bookmark and the module counts progress is derived from.
+type LearnerCourse struct {
+	ID               int
+	Title            string
+	Description      string
+	Level            string
+	Duration         string
+	Instructor       string
+	VideoUrl         string
+	Enrolled         bool
+	Bookmarked       bool
+	Completed        bool
+	EnrollmentStatus string
+	CompletedModules int
+	TotalModules     int
 }
 
 type CourseResponse struct {
@@ -30,12 +73,215 @@ type CourseResponse struct {
 	Enrolled    bool   `json:"enrolled"`
 }
 
+// Enrollment states stored in user_courses.status. A dropped enrollment is
+// kept so that completed modules survive re-enrolling.
+const (
+	EnrollmentActive    = "active"
+	EnrollmentPaused    = "paused"
+	EnrollmentDropped   = "dropped"
+	EnrollmentCompleted = "completed"
+)
+
 type UserCourse struct {
+	ID              int    `json:"id"`
+	UserID          int    `json:"userId"`
+	CourseID        int    `json:"courseId"`
+	Progress        int    `json:"progress"`
+	Completed       bool   `json:"completed"`
+	Status          string `json:"status"`
+	EnrolledAt      string `json:"enrolledAt"`
+	StatusChangedAt string `json:"statusChangedAt,omitempty"`
+	PausedAt        string `json:"pausedAt,omitempty"`
+	DroppedAt       string `json:"droppedAt,omitempty"`
+	CompletedAt     string `json:"completedAt,omitempty"`
+}
+
+// BookmarkedCourse is a course on a learner's bookmark list together with
+// their enrollment and progress in it.
+type BookmarkedCourse struct {
+	ID               int    `json:"id"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	Level            string `json:"level"`
+	Duration         string `json:"duration"`
+	Instructor       string `json:"instructor"`
+	VideoUrl         string `json:"videoUrl"`
+	Enrolled         bool   `json:"enrolled"`
+	Completed        bool   `json:"completed"`
+	Progress         int    `json:"progress"`
+	CompletedModules int    `json:"completedModules"`
+	TotalModules     int    `json:"totalModules"`
+}
+
+type Activity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	CourseID  int       `json:"courseId"`
+	Title     string    `json:"title"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"date"`
+}
+
+type CourseModule struct {
+	ID            int    `json:"id"`
+	CourseID      int    `json:"courseId"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	Content       string `json:"content"`
+	VideoUrl      string `json:"videoUrl"`
+	Order         int    `json:"order"`
+	AutoGenerated bool   `json:"autoGenerated"`
+}
+
+// AutoGeneratedModule is a module flagged as placeholder content, with the
+// number of learners who completed it.
+type AutoGeneratedModule struct {
 	ID          int    `json:"id"`
-	UserID      int    `json:"userId"`
 	CourseID    int    `json:"courseId"`
-	Progress    int    `json:"progress"`
-	Completed   bool   `json:"completed"`
-	EnrolledAt  string `json:"enrolledAt"`
-	CompletedAt string `json:"completedAt,omitempty"`
+	CourseTitle string `json:"courseTitle"`
+	Title       string `json:"title"`
+	Completions int64  `json:"completions"`
+}
+
+// Reasons a completion shows up in the dangling progress report.
+const (
+	DanglingModuleMissing  = "module_missing"
+	DanglingCourseMismatch = "course_mismatch"
+	DanglingAutoGenerated  = "auto_generated"
+)
+
+// DanglingCompletion is a completed module that no longer points at a valid
+// module of its course.
+type DanglingCompletion struct {
+	UserID      int
+	CourseID    int
+	ModuleID    int
+	CompletedAt *time.Time
+	Reason      string
+	// ModuleCourseID is the course the module belongs to now, if it exists.
+	ModuleCourseID *int
+}
+
+// DuplicateModule is a module that shares its title with an earlier module
+// of the same course, the survivor.
+type DuplicateModule struct {
+	CourseID    int    `json:"courseId"`
+	ModuleID    int    `json:"moduleId"`
+	Title       string `json:"title"`
+	SurvivorID  int    `json:"survivorId"`
+	Completions int    `json:"completions"`
+}
+
+type TemplateModule struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	VideoUrl    string `json:"videoUrl"`
+}
+
+type CourseTemplate struct {
+	ID          int              `json:"id"`
+	Name        string           `json:"name"`
+	Level       string           `json:"level,omitempty"`
+	Description string           `json:"description"`
+	Modules     []TemplateModule `json:"modules"`
+}
+
+// Maintenance run states stored in maintenance_runs.status.
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+type MaintenanceRun struct {
+	ID         int64           `json:"id"`
+	Job        string          `json:"job"`
+	ActorID    *int            `json:"actorId"`
+	DryRun     bool            `json:"dryRun"`
+	Status     string          `json:"status"`
+	StartedAt  string          `json:"startedAt"`
+	FinishedAt string          `json:"finishedAt,omitempty"`
+	Summary    json.RawMessage `json:"summary,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// AuditEntry is one row of the append-only audit log. Before and After hold
+// the state of the target around the change, when it has one.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	OccurredAt string          `json:"occurredAt"`
+	ActorID    *int            `json:"actorId"`
+	ActorRole  string          `json:"actorRole,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+}
+
+// NewUser is an account about to be created. PasswordHash is the bcrypt
+// hash of its password.
+type NewUser struct {
+	Username      string
+	Email         string
+	PasswordHash  string
+	Role          string
+	EmailVerified bool
+}
+
+// ProfileUpdate changes the fields that are not nil. ResetVerification
+// marks the email as unverified again.
+type ProfileUpdate struct {
+	Username          *string
+	Email             *string
+	Status            *string
+	ResetVerification bool
+}
+
+// RefreshToken is a stored refresh token; only the hash of the token the
+// client holds is kept.
+type RefreshToken struct {
+	ID        int64
+	UserID    int
+	FamilyID  string
+	Hash      string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	UserAgent string
+	IP        string
+	MFA       bool
+}
+
+// LoginThrottle is the failure counter of one scope and key. UserID is set
+// for account counters whose key is a registered email.
+type LoginThrottle struct {
+	Scope         string
+	Key           string
+	UserID        *int
+	Failures      int
+	LastFailureAt *time.Time
+	LockedUntil   *time.Time
+	Locked        bool
+}
+
+// TOTPSecret is a user's TOTP secret; EnabledAt is nil until setup is
+// confirmed with a first code.
+type TOTPSecret struct {
+	UserID       int
+	Secret       string
+	LastUsedStep int64
+	EnabledAt    *time.Time
+}
+
+type PasswordReset struct {
+	ID        int64
+	UserID    int
+	Hash      string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	IP        string
 }
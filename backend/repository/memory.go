@@ -0,0 +1,1899 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+)
+
+// MemoryStore is an in-memory Store for tests. Transactions are serialised
+// and roll back by restoring a copy of the data taken when they began;
+// calls made outside WithTx while one is running can see its changes.
+type MemoryStore struct {
+	mu   sync.Mutex
+	txMu sync.Mutex
+	data memoryData
+	// Now is the clock used for timestamps; tests may replace it.
+	Now func() time.Time
+}
+
+type memoryEnrollment struct {
+	id              int
+	userID          int
+	courseID        int
+	status          string
+	completed       bool
+	enrolledAt      time.Time
+	statusChangedAt time.Time
+	pausedAt        *time.Time
+	droppedAt       *time.Time
+	completedAt     *time.Time
+}
+
+type memoryBookmark struct {
+	userID    int
+	courseID  int
+	createdAt time.Time
+}
+
+type memoryAuditEntry struct {
+	models.AuditEntry
+	occurredAt time.Time
+}
+
+type memoryRun struct {
+	models.MaintenanceRun
+	startedAt time.Time
+}
+
+type memoryData struct {
+	lastID      int
+	courses     map[int]models.Course
+	modules     map[int]models.CourseModule
+	enrollments []memoryEnrollment
+	// completions maps user ID and module ID to the module's course.
+	completions map[[2]int]int
+	bookmarks   []memoryBookmark
+	activities  []models.Activity
+	users       map[int]models.AdminUser
+	// passwords holds the users' password hashes.
+	passwords     map[int]string
+	refreshTokens []models.RefreshToken
+	throttles     map[ThrottleKey]models.LoginThrottle
+	totp          map[int]models.TOTPSecret
+	recoveryCodes []memoryRecoveryCode
+	resets        []models.PasswordReset
+	templates     []models.CourseTemplate
+	audit         []memoryAuditEntry
+	runs          []memoryRun
+}
+
+func (d *memoryData) clone() memoryData {
+	c := *d
+	c.courses = make(map[int]models.Course, len(d.courses))
+	for k, v := range d.courses {
+		c.courses[k] = v
+	}
+	c.modules = make(map[int]models.CourseModule, len(d.modules))
+	for k, v := range d.modules {
+		c.modules[k] = v
+	}
+	c.completions = make(map[[2]int]int, len(d.completions))
+	for k, v := range d.completions {
+		c.completions[k] = v
+	}
+	c.users = make(map[int]models.AdminUser, len(d.users))
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	c.passwords = make(map[int]string, len(d.passwords))
+	for k, v := range d.passwords {
+		c.passwords[k] = v
+	}
+	c.throttles = make(map[ThrottleKey]models.LoginThrottle, len(d.throttles))
+	for k, v := range d.throttles {
+		c.throttles[k] = v
+	}
+	c.totp = make(map[int]models.TOTPSecret, len(d.totp))
+	for k, v := range d.totp {
+		c.totp[k] = v
+	}
+	c.refreshTokens = append([]models.RefreshToken(nil), d.refreshTokens...)
+	c.recoveryCodes = append([]memoryRecoveryCode(nil), d.recoveryCodes...)
+	c.resets = append([]models.PasswordReset(nil), d.resets...)
+	c.enrollments = append([]memoryEnrollment(nil), d.enrollments...)
+	c.bookmarks = append([]memoryBookmark(nil), d.bookmarks...)
+	c.activities = append([]models.Activity(nil), d.activities...)
+	c.templates = append([]models.CourseTemplate(nil), d.templates...)
+	c.audit = append([]memoryAuditEntry(nil), d.audit...)
+	c.runs = append([]memoryRun(nil), d.runs...)
+	return c
+}
+
+func (d *memoryData) nextID() int {
+	d.lastID++
+	return d.lastID
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data: memoryData{
+			courses:     map[int]models.Course{},
+			modules:     map[int]models.CourseModule{},
+			completions: map[[2]int]int{},
+			users:       map[int]models.AdminUser{},
+			passwords:   map[int]string{},
+			throttles:   map[ThrottleKey]models.LoginThrottle{},
+			totp:        map[int]models.TOTPSecret{},
+		},
+		Now: time.Now,
+	}
+}
+
+// AddUser seeds a user and returns its ID.
+func (s *MemoryStore) AddUser(emailVerified bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.data.nextID()
+	u := models.AdminUser{ID: id, Username: fmt.Sprintf("user%d", id), Email: fmt.Sprintf("user%d@example.com", id), Role: "user"}
+	if emailVerified {
+		now := s.Now()
+		u.EmailVerifiedAt = &now
+	}
+	s.data.users[id] = u
+	return id
+}
+
+// AddCourse seeds a course and returns its ID.
+func (s *MemoryStore) AddCourse(title string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.data.nextID()
+	s.data.courses[id] = models.Course{ID: id, Title: title}
+	return id
+}
+
+func (s *MemoryStore) ArchiveCourse(courseID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.data.courses[courseID]
+	now := s.Now()
+	c.ArchivedAt = &now
+	s.data.courses[courseID] = c
+}
+
+// AddModule seeds a module of courseID and returns its ID.
+func (s *MemoryStore) AddModule(courseID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.data.nextID()
+	order := 1
+	for _, m := range s.data.modules {
+		if m.CourseID == courseID {
+			order++
+		}
+	}
+	s.data.modules[id] = models.CourseModule{ID: id, CourseID: courseID, Title: fmt.Sprintf("Module %d", order), Order: order}
+	return id
+}
+
+// AddTemplate seeds a course template and returns its ID.
+func (s *MemoryStore) AddTemplate(t models.CourseTemplate) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.ID = s.data.nextID()
+	s.data.templates = append(s.data.templates, t)
+	return t.ID
+}
+
+// UserProgress returns what SetProgress last stored for a user.
+func (s *MemoryStore) UserProgress(userID int) (progress, completedCourses int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.data.users[userID]
+	return u.Progress, u.CompletedCourses
+}
+
+func (s *MemoryStore) Courses() CourseRepository               { return memoryCourses{s} }
+func (s *MemoryStore) Modules() ModuleRepository               { return memoryModules{s} }
+func (s *MemoryStore) Enrollments() EnrollmentRepository       { return memoryEnrollments{s} }
+func (s *MemoryStore) Bookmarks() BookmarkRepository           { return memoryBookmarks{s} }
+func (s *MemoryStore) Activities() ActivityRepository          { return memoryActivities{s} }
+func (s *MemoryStore) Users() UserRepository                   { return memoryUsers{s} }
+func (s *MemoryStore) Sessions() SessionRepository             { return memorySessions{s} }
+func (s *MemoryStore) Throttles() ThrottleRepository           { return memoryThrottles{s} }
+func (s *MemoryStore) TwoFactor() TwoFactorRepository          { return memoryTwoFactor{s} }
+func (s *MemoryStore) PasswordResets() PasswordResetRepository { return memoryPasswordResets{s} }
+func (s *MemoryStore) Templates() TemplateRepository           { return memoryTemplates{s} }
+func (s *MemoryStore) Audit() AuditRepository                  { return memoryAudit{s} }
+func (s *MemoryStore) Maintenance() MaintenanceRepository      { return memoryMaintenance{s} }
+
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	saved := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(memoryTx{s}); err != nil {
+		s.mu.Lock()
+		s.data = saved
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// memoryTx is the Store passed to WithTx callbacks; nested calls join the
+// running transaction instead of waiting for it.
+type memoryTx struct{ *MemoryStore }
+
+func (t memoryTx) WithTx(ctx context.Context, fn func(Store) error) error {
+	return fn(t)
+}
+
+// locked runs fn with the data locked.
+func (s *MemoryStore) locked(fn func(d *memoryData)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.data)
+}
+
+// moduleCounts counts a course's modules and those the user completed.
+func (d *memoryData) moduleCounts(userID, courseID int) (completed, total int) {
+	for id, m := range d.modules {
+		if m.CourseID != courseID {
+			continue
+		}
+		total++
+		if c, ok := d.completions[[2]int{userID, id}]; ok && c == courseID {
+			completed++
+		}
+	}
+	return completed, total
+}
+
+func (d *memoryData) enrollment(userID, courseID int) *memoryEnrollment {
+	for i := range d.enrollments {
+		if d.enrollments[i].userID == userID && d.enrollments[i].courseID == courseID {
+			return &d.enrollments[i]
+		}
+	}
+	return nil
+}
+
+type memoryCourses struct{ s *MemoryStore }
+
+func (r memoryCourses) Exists(ctx context.Context, courseID int) (exists bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		c, ok := d.courses[courseID]
+		exists = ok && c.ArchivedAt == nil
+	})
+	return exists, nil
+}
+
+func (r memoryCourses) Title(ctx context.Context, courseID int) (title string, err error) {
+	r.s.locked(func(d *memoryData) {
+		c, ok := d.courses[courseID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		title = c.Title
+	})
+	return title, err
+}
+
+func (r memoryCourses) Find(ctx context.Context, courseID int) (c models.Course, err error) {
+	r.s.locked(func(d *memoryData) {
+		var ok bool
+		if c, ok = d.courses[courseID]; !ok {
+			err = ErrNotFound
+		}
+	})
+	return c, err
+}
+
+// Lock is Find: transactions are serialised already.
+func (r memoryCourses) Lock(ctx context.Context, courseID int) (models.Course, error) {
+	return r.Find(ctx, courseID)
+}
+
+// learnerCourse returns c as the user sees it.
+func (d *memoryData) learnerCourse(userID int, c models.Course) models.LearnerCourse {
+	lc := models.LearnerCourse{
+		ID: c.ID, Title: c.Title, Description: c.Description, Level: c.Level,
+		Duration: c.Duration, Instructor: c.Instructor, VideoUrl: c.VideoUrl,
+	}
+	if e := d.enrollment(userID, c.ID); e != nil {
+		lc.Enrolled = e.status != models.EnrollmentDropped
+		lc.Completed = e.completed
+		lc.EnrollmentStatus = e.status
+	}
+	for _, b := range d.bookmarks {
+		if b.userID == userID && b.courseID == c.ID {
+			lc.Bookmarked = true
+		}
+	}
+	lc.CompletedModules, lc.TotalModules = d.moduleCounts(userID, c.ID)
+	return lc
+}
+
+// liveCourses returns the courses that are not archived, by ID.
+func (d *memoryData) liveCourses() []models.Course {
+	var courses []models.Course
+	for _, c := range d.courses {
+		if c.ArchivedAt == nil {
+			courses = append(courses, c)
+		}
+	}
+	sort.Slice(courses, func(i, j int) bool { return courses[i].ID < courses[j].ID })
+	return courses
+}
+
+func (r memoryCourses) List(ctx context.Context, userID int) (courses []models.LearnerCourse, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, c := range d.liveCourses() {
+			courses = append(courses, d.learnerCourse(userID, c))
+		}
+	})
+	return courses, nil
+}
+
+func (r memoryCourses) Search(ctx context.Context, userID int, query string, limit int) (courses []models.LearnerCourse, err error) {
+	query = strings.ToLower(query)
+	r.s.locked(func(d *memoryData) {
+		for _, c := range d.liveCourses() {
+			if strings.Contains(strings.ToLower(c.Title), query) || strings.Contains(strings.ToLower(c.Description), query) {
+				courses = append(courses, d.learnerCourse(userID, c))
+			}
+		}
+	})
+	rank := func(c models.LearnerCourse) int {
+		title := strings.ToLower(c.Title)
+		switch {
+		case strings.HasPrefix(title, query):
+			return 0
+		case strings.Contains(title, query):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(courses, func(i, j int) bool {
+		if ri, rj := rank(courses[i]), rank(courses[j]); ri != rj {
+			return ri < rj
+		}
+		return courses[i].Title < courses[j].Title
+	})
+	if len(courses) > limit {
+		courses = courses[:limit]
+	}
+	return courses, nil
+}
+
+func (r memoryCourses) Get(ctx context.Context, userID, courseID int) (lc models.LearnerCourse, err error) {
+	r.s.locked(func(d *memoryData) {
+		c, ok := d.courses[courseID]
+		if !ok || c.ArchivedAt != nil {
+			err = ErrNotFound
+			return
+		}
+		lc = d.learnerCourse(userID, c)
+	})
+	return lc, err
+}
+
+func (r memoryCourses) Count(ctx context.Context) (count int, err error) {
+	r.s.locked(func(d *memoryData) {
+		count = len(d.liveCourses())
+	})
+	return count, nil
+}
+
+func (r memoryCourses) Page(ctx context.Context, offset, limit int) (courses []models.Course, err error) {
+	r.s.locked(func(d *memoryData) {
+		live := d.liveCourses()
+		if offset >= len(live) {
+			return
+		}
+		live = live[offset:]
+		if len(live) > limit {
+			live = live[:limit]
+		}
+		courses = live
+	})
+	return courses, nil
+}
+
+func (r memoryCourses) Create(ctx context.Context, c models.Course) (id int, err error) {
+	r.s.locked(func(d *memoryData) {
+		id = d.nextID()
+		c.ID, c.ArchivedAt = id, nil
+		d.courses[id] = c
+	})
+	return id, nil
+}
+
+func (r memoryCourses) Update(ctx context.Context, c models.Course) error {
+	r.s.locked(func(d *memoryData) {
+		old, ok := d.courses[c.ID]
+		if !ok {
+			return
+		}
+		c.OwnerID, c.ArchivedAt, c.ArchivedBy = old.OwnerID, old.ArchivedAt, old.ArchivedBy
+		d.courses[c.ID] = c
+	})
+	return nil
+}
+
+func (r memoryCourses) Archive(ctx context.Context, courseID, by int) (archivedAt time.Time, err error) {
+	r.s.locked(func(d *memoryData) {
+		c, ok := d.courses[courseID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		archivedAt = r.s.Now()
+		c.ArchivedAt, c.ArchivedBy = &archivedAt, &by
+		d.courses[courseID] = c
+	})
+	return archivedAt, err
+}
+
+func (r memoryCourses) Restore(ctx context.Context, courseID int) error {
+	r.s.locked(func(d *memoryData) {
+		if c, ok := d.courses[courseID]; ok {
+			c.ArchivedAt, c.ArchivedBy = nil, nil
+			d.courses[courseID] = c
+		}
+	})
+	return nil
+}
+
+func (r memoryCourses) Archived(ctx context.Context, ownerID int) (courses []models.Course, err error) {
+	courses = []models.Course{}
+	r.s.locked(func(d *memoryData) {
+		for _, c := range d.courses {
+			if c.ArchivedAt != nil && (ownerID == 0 || c.OwnerID != nil && *c.OwnerID == ownerID) {
+				courses = append(courses, c)
+			}
+		}
+	})
+	sort.Slice(courses, func(i, j int) bool { return courses[i].ArchivedAt.After(*courses[j].ArchivedAt) })
+	return courses, nil
+}
+
+func (r memoryCourses) ArchivedBefore(ctx context.Context, cutoff time.Time) (ids []int, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, c := range d.courses {
+			if c.ArchivedAt != nil && c.ArchivedAt.Before(cutoff) {
+				ids = append(ids, c.ID)
+			}
+		}
+	})
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r memoryCourses) Purge(ctx context.Context, courseID int) error {
+	r.s.locked(func(d *memoryData) {
+		for id, m := range d.modules {
+			if m.CourseID == courseID {
+				d.removeModule(id)
+			}
+		}
+		for key, c := range d.completions {
+			if c == courseID {
+				delete(d.completions, key)
+			}
+		}
+		var enrollments []memoryEnrollment
+		for _, e := range d.enrollments {
+			if e.courseID != courseID {
+				enrollments = append(enrollments, e)
+			}
+		}
+		var bookmarks []memoryBookmark
+		for _, b := range d.bookmarks {
+			if b.courseID != courseID {
+				bookmarks = append(bookmarks, b)
+			}
+		}
+		var activities []models.Activity
+		for _, a := range d.activities {
+			if a.CourseID != courseID {
+				activities = append(activities, a)
+			}
+		}
+		d.enrollments, d.bookmarks, d.activities = enrollments, bookmarks, activities
+		delete(d.courses, courseID)
+	})
+	return nil
+}
+
+type memoryModules struct{ s *MemoryStore }
+
+func (r memoryModules) CourseID(ctx context.Context, moduleID int) (courseID int, err error) {
+	r.s.locked(func(d *memoryData) {
+		m, ok := d.modules[moduleID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		courseID = m.CourseID
+	})
+	return courseID, err
+}
+
+// courseModules returns the course's modules in order, ties broken by ID.
+func (d *memoryData) courseModules(courseID int) []models.CourseModule {
+	modules := []models.CourseModule{}
+	for _, m := range d.modules {
+		if m.CourseID == courseID {
+			modules = append(modules, m)
+		}
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Order != modules[j].Order {
+			return modules[i].Order < modules[j].Order
+		}
+		return modules[i].ID < modules[j].ID
+	})
+	return modules
+}
+
+func (r memoryModules) ForCourse(ctx context.Context, courseID int) (modules []models.CourseModule, err error) {
+	r.s.locked(func(d *memoryData) {
+		modules = d.courseModules(courseID)
+	})
+	return modules, nil
+}
+
+// Lock is ForCourse: transactions are serialised already.
+func (r memoryModules) Lock(ctx context.Context, courseID int) ([]models.CourseModule, error) {
+	return r.ForCourse(ctx, courseID)
+}
+
+func (r memoryModules) Count(ctx context.Context, courseID int) (count int, err error) {
+	r.s.locked(func(d *memoryData) {
+		count = len(d.courseModules(courseID))
+	})
+	return count, nil
+}
+
+func (r memoryModules) Get(ctx context.Context, courseID, moduleID int) (m models.CourseModule, err error) {
+	r.s.locked(func(d *memoryData) {
+		var ok bool
+		if m, ok = d.modules[moduleID]; !ok || m.CourseID != courseID {
+			m, err = models.CourseModule{}, ErrNotFound
+		}
+	})
+	return m, err
+}
+
+func (r memoryModules) Create(ctx context.Context, m models.CourseModule) (id int, err error) {
+	r.s.locked(func(d *memoryData) {
+		id = d.nextID()
+		m.ID = id
+		d.modules[id] = m
+	})
+	return id, nil
+}
+
+func (r memoryModules) Update(ctx context.Context, m models.CourseModule) error {
+	r.s.locked(func(d *memoryData) {
+		old, ok := d.modules[m.ID]
+		if !ok || old.CourseID != m.CourseID {
+			return
+		}
+		m.AutoGenerated = old.AutoGenerated
+		d.modules[m.ID] = m
+	})
+	return nil
+}
+
+func (r memoryModules) SetAutoGenerated(ctx context.Context, moduleID int, autoGenerated bool) error {
+	r.s.locked(func(d *memoryData) {
+		if m, ok := d.modules[moduleID]; ok {
+			m.AutoGenerated = autoGenerated
+			d.modules[moduleID] = m
+		}
+	})
+	return nil
+}
+
+func (r memoryModules) AutoGenerated(ctx context.Context) (modules []models.AutoGeneratedModule, err error) {
+	modules = []models.AutoGeneratedModule{}
+	r.s.locked(func(d *memoryData) {
+		var flagged []models.CourseModule
+		for _, m := range d.modules {
+			if m.AutoGenerated {
+				flagged = append(flagged, m)
+			}
+		}
+		sort.Slice(flagged, func(i, j int) bool {
+			a, b := flagged[i], flagged[j]
+			if a.CourseID != b.CourseID {
+				return a.CourseID < b.CourseID
+			}
+			if a.Order != b.Order {
+				return a.Order < b.Order
+			}
+			return a.ID < b.ID
+		})
+		for _, m := range flagged {
+			entry := models.AutoGeneratedModule{
+				ID: m.ID, CourseID: m.CourseID, CourseTitle: d.courses[m.CourseID].Title, Title: m.Title,
+			}
+			for key := range d.completions {
+				if key[1] == m.ID {
+					entry.Completions++
+				}
+			}
+			modules = append(modules, entry)
+		}
+	})
+	return modules, nil
+}
+
+// Dangling leaves CompletedAt unset: MemoryStore does not keep it.
+func (r memoryModules) Dangling(ctx context.Context) (dangling []models.DanglingCompletion, err error) {
+	dangling = []models.DanglingCompletion{}
+	r.s.locked(func(d *memoryData) {
+		for key, courseID := range d.completions {
+			c := models.DanglingCompletion{UserID: key[0], CourseID: courseID, ModuleID: key[1]}
+			m, ok := d.modules[key[1]]
+			switch {
+			case !ok:
+				c.Reason = models.DanglingModuleMissing
+			case m.CourseID != courseID:
+				c.Reason = models.DanglingCourseMismatch
+			case m.AutoGenerated:
+				c.Reason = models.DanglingAutoGenerated
+			default:
+				continue
+			}
+			if ok {
+				c.ModuleCourseID = &m.CourseID
+			}
+			dangling = append(dangling, c)
+		}
+	})
+	sort.Slice(dangling, func(i, j int) bool {
+		a, b := dangling[i], dangling[j]
+		if a.CourseID != b.CourseID {
+			return a.CourseID < b.CourseID
+		}
+		if a.ModuleID != b.ModuleID {
+			return a.ModuleID < b.ModuleID
+		}
+		return a.UserID < b.UserID
+	})
+	return dangling, nil
+}
+
+func (r memoryModules) Delete(ctx context.Context, courseID int, moduleIDs []int) (removed int64, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, id := range moduleIDs {
+			if m, ok := d.modules[id]; ok && m.CourseID == courseID {
+				removed += d.removeModule(id)
+			}
+		}
+	})
+	return removed, nil
+}
+
+// removeModule deletes a module and its completions and returns how many
+// completions went with it.
+func (d *memoryData) removeModule(moduleID int) int64 {
+	var removed int64
+	for key := range d.completions {
+		if key[1] == moduleID {
+			delete(d.completions, key)
+			removed++
+		}
+	}
+	delete(d.modules, moduleID)
+	return removed
+}
+
+func (r memoryModules) Renumber(ctx context.Context, courseID int) error {
+	r.s.locked(func(d *memoryData) {
+		for i, m := range d.courseModules(courseID) {
+			m.Order = i + 1
+			d.modules[m.ID] = m
+		}
+	})
+	return nil
+}
+
+func (r memoryModules) Duplicates(ctx context.Context) (dups []models.DuplicateModule, err error) {
+	dups = []models.DuplicateModule{}
+	r.s.locked(func(d *memoryData) {
+		courseIDs := map[int]bool{}
+		for _, m := range d.modules {
+			courseIDs[m.CourseID] = true
+		}
+		for courseID := range courseIDs {
+			survivors := map[string]int{}
+			for _, m := range d.courseModules(courseID) {
+				survivorID, ok := survivors[m.Title]
+				if !ok {
+					survivors[m.Title] = m.ID
+					continue
+				}
+				dup := models.DuplicateModule{CourseID: courseID, ModuleID: m.ID, Title: m.Title, SurvivorID: survivorID}
+				for key := range d.completions {
+					if key[1] == m.ID {
+						dup.Completions++
+					}
+				}
+				dups = append(dups, dup)
+			}
+		}
+	})
+	sort.Slice(dups, func(i, j int) bool {
+		a, b := dups[i], dups[j]
+		if a.CourseID != b.CourseID {
+			return a.CourseID < b.CourseID
+		}
+		if a.SurvivorID != b.SurvivorID {
+			return a.SurvivorID < b.SurvivorID
+		}
+		return a.ModuleID < b.ModuleID
+	})
+	return dups, nil
+}
+
+func (r memoryModules) Merge(ctx context.Context, duplicates []models.DuplicateModule) error {
+	r.s.locked(func(d *memoryData) {
+		for _, dup := range duplicates {
+			survivor, ok := d.modules[dup.SurvivorID]
+			if !ok {
+				continue
+			}
+			for key := range d.completions {
+				if key[1] == dup.ModuleID {
+					d.completions[[2]int{key[0], survivor.ID}] = survivor.CourseID
+				}
+			}
+			d.removeModule(dup.ModuleID)
+		}
+	})
+	return nil
+}
+
+func (r memoryModules) Completed(ctx context.Context, userID, courseID int) (completed map[int]bool, err error) {
+	completed = map[int]bool{}
+	r.s.locked(func(d *memoryData) {
+		for key, c := range d.completions {
+			if key[0] == userID && c == courseID {
+				completed[key[1]] = true
+			}
+		}
+	})
+	return completed, nil
+}
+func (r memoryModules) Complete(ctx context.Context, userID, courseID, moduleID int) error {
+	r.s.locked(func(d *memoryData) {
+		key := [2]int{userID, moduleID}
+		if _, ok := d.completions[key]; !ok {
+			d.completions[key] = courseID
+		}
+	})
+	return nil
+}
+
+func (r memoryModules) Uncomplete(ctx context.Context, userID, moduleID int) error {
+	r.s.locked(func(d *memoryData) {
+		delete(d.completions, [2]int{userID, moduleID})
+	})
+	return nil
+}
+
+func (r memoryModules) Progress(ctx context.Context, userID, courseID int) (completed, total int, err error) {
+	r.s.locked(func(d *memoryData) {
+		if _, ok := d.courses[courseID]; !ok {
+			err = ErrNotFound
+			return
+		}
+		completed, total = d.moduleCounts(userID, courseID)
+	})
+	return completed, total, err
+}
+
+type memoryEnrollments struct{ s *MemoryStore }
+
+func (r memoryEnrollments) Status(ctx context.Context, userID, courseID int) (status string, err error) {
+	r.s.locked(func(d *memoryData) {
+		e := d.enrollment(userID, courseID)
+		if e == nil {
+			err = ErrNotFound
+			return
+		}
+		status = e.status
+	})
+	return status, err
+}
+
+func (r memoryEnrollments) Get(ctx context.Context, userID, courseID int) (e models.UserCourse, err error) {
+	r.s.locked(func(d *memoryData) {
+		m := d.enrollment(userID, courseID)
+		if m == nil {
+			err = ErrNotFound
+			return
+		}
+		e = models.UserCourse{
+			ID: m.id, UserID: userID, CourseID: courseID, Completed: m.completed, Status: m.status,
+			EnrolledAt:      formatTime(&m.enrolledAt),
+			StatusChangedAt: formatTime(&m.statusChangedAt),
+			PausedAt:        formatTime(m.pausedAt),
+			DroppedAt:       formatTime(m.droppedAt),
+			CompletedAt:     formatTime(m.completedAt),
+		}
+	})
+	return e, err
+}
+
+func (r memoryEnrollments) Transition(ctx context.Context, userID, courseID int, target string) (from string, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		e := d.enrollment(userID, courseID)
+		if e == nil {
+			if target != models.EnrollmentActive {
+				err = ErrNotFound
+				return
+			}
+			d.enrollments = append(d.enrollments, memoryEnrollment{
+				id: d.nextID(), userID: userID, courseID: courseID, status: models.EnrollmentActive,
+				enrolledAt: now, statusChangedAt: now,
+			})
+			return
+		}
+
+		from = e.status
+		var change bool
+		if change, err = transitionChanges(from, target); !change {
+			return
+		}
+		e.status, e.statusChangedAt = target, now
+		switch target {
+		case models.EnrollmentPaused:
+			e.pausedAt = &now
+		case models.EnrollmentDropped:
+			e.droppedAt = &now
+		}
+	})
+	return from, err
+}
+
+func (r memoryEnrollments) MarkCompleted(ctx context.Context, userID, courseID int) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		if e := d.enrollment(userID, courseID); e != nil && !e.completed {
+			e.completed = true
+			e.status, e.statusChangedAt = models.EnrollmentCompleted, now
+			e.completedAt = &now
+		}
+	})
+	return nil
+}
+
+func (r memoryEnrollments) Reopen(ctx context.Context, userID, courseID int) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		if e := d.enrollment(userID, courseID); e != nil && e.completed {
+			e.completed = false
+			e.status, e.statusChangedAt = models.EnrollmentActive, now
+			e.completedAt = nil
+		}
+	})
+	return nil
+}
+
+func (r memoryEnrollments) CountCompleted(ctx context.Context, userID int) (count int, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, e := range d.enrollments {
+			if e.userID == userID && e.completed {
+				count++
+			}
+		}
+	})
+	return count, nil
+}
+
+func (r memoryEnrollments) ModuleTotals(ctx context.Context, userID int) (completed, total int, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, e := range d.enrollments {
+			if e.userID != userID || e.status == models.EnrollmentDropped || d.courses[e.courseID].ArchivedAt != nil {
+				continue
+			}
+			c, t := d.moduleCounts(userID, e.courseID)
+			completed += c
+			total += t
+		}
+	})
+	return completed, total, nil
+}
+
+type memoryBookmarks struct{ s *MemoryStore }
+
+func (r memoryBookmarks) Exists(ctx context.Context, userID, courseID int) (exists bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, b := range d.bookmarks {
+			if b.userID == userID && b.courseID == courseID {
+				exists = true
+				return
+			}
+		}
+	})
+	return exists, nil
+}
+
+func (r memoryBookmarks) Add(ctx context.Context, userID, courseID int) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		d.bookmarks = append(d.bookmarks, memoryBookmark{userID: userID, courseID: courseID, createdAt: now})
+	})
+	return nil
+}
+
+func (r memoryBookmarks) Remove(ctx context.Context, userID, courseID int) error {
+	r.s.locked(func(d *memoryData) {
+		kept := d.bookmarks[:0]
+		for _, b := range d.bookmarks {
+			if b.userID != userID || b.courseID != courseID {
+				kept = append(kept, b)
+			}
+		}
+		d.bookmarks = kept
+	})
+	return nil
+}
+
+func (r memoryBookmarks) Courses(ctx context.Context, userID int) (courses []models.BookmarkedCourse, err error) {
+	r.s.locked(func(d *memoryData) {
+		// Walk backwards so bookmarks made at the same instant still list
+		// the latest first.
+		var bookmarks []memoryBookmark
+		for i := len(d.bookmarks) - 1; i >= 0; i-- {
+			b := d.bookmarks[i]
+			if b.userID == userID && d.courses[b.courseID].ArchivedAt == nil {
+				bookmarks = append(bookmarks, b)
+			}
+		}
+		sort.SliceStable(bookmarks, func(i, j int) bool {
+			return bookmarks[i].createdAt.After(bookmarks[j].createdAt)
+		})
+
+		for _, b := range bookmarks {
+			course := d.courses[b.courseID]
+			c := models.BookmarkedCourse{
+				ID: course.ID, Title: course.Title, Description: course.Description, Level: course.Level,
+				Duration: course.Duration, Instructor: course.Instructor, VideoUrl: course.VideoUrl,
+			}
+			if e := d.enrollment(userID, b.courseID); e != nil {
+				c.Enrolled = e.status != models.EnrollmentDropped
+				c.Completed = e.completed
+			}
+			c.CompletedModules, c.TotalModules = d.moduleCounts(userID, b.courseID)
+			courses = append(courses, c)
+		}
+	})
+	return courses, nil
+}
+
+type memoryActivities struct{ s *MemoryStore }
+
+func (r memoryActivities) Touch(ctx context.Context, userID, courseID int, activityType string, window time.Duration) (found bool, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		newest := -1
+		for i, a := range d.activities {
+			if a.UserID != userID || a.CourseID != courseID || a.Type != activityType ||
+				!a.CreatedAt.After(now.Add(-window)) {
+				continue
+			}
+			if newest < 0 || a.CreatedAt.After(d.activities[newest].CreatedAt) {
+				newest = i
+			}
+		}
+		if newest >= 0 {
+			d.activities[newest].CreatedAt = now
+			found = true
+		}
+	})
+	return found, nil
+}
+
+func (r memoryActivities) Create(ctx context.Context, a models.Activity) error {
+	r.s.locked(func(d *memoryData) {
+		a.ID = d.nextID()
+		d.activities = append(d.activities, a)
+	})
+	return nil
+}
+
+func (r memoryActivities) Recent(ctx context.Context, userID, limit int) (activities []models.Activity, err error) {
+	r.s.locked(func(d *memoryData) {
+		for i := len(d.activities) - 1; i >= 0; i-- {
+			if d.activities[i].UserID == userID {
+				activities = append(activities, d.activities[i])
+			}
+		}
+	})
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].CreatedAt.After(activities[j].CreatedAt)
+	})
+	if len(activities) > limit {
+		activities = activities[:limit]
+	}
+	return activities, nil
+}
+
+type memoryUsers struct{ s *MemoryStore }
+
+func (r memoryUsers) Profile(ctx context.Context, userID int) (p models.User, err error) {
+	r.s.locked(func(d *memoryData) {
+		u, ok := d.users[userID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		p = models.User{
+			ID: u.ID, Username: u.Username, Email: u.Email, Role: u.Role,
+			Progress: u.Progress, CompletedCourses: u.CompletedCourses, Status: u.Status,
+			EmailVerified: u.EmailVerifiedAt != nil,
+		}
+		if p.Status == "" {
+			p.Status = "Pemula React Native"
+		}
+	})
+	return p, err
+}
+
+func (r memoryUsers) Admin(ctx context.Context, userID int) (u models.AdminUser, err error) {
+	r.s.locked(func(d *memoryData) {
+		var ok bool
+		if u, ok = d.users[userID]; !ok {
+			err = ErrNotFound
+			return
+		}
+		u = d.adminUser(u)
+	})
+	return u, err
+}
+
+func (r memoryUsers) Search(ctx context.Context, f UserFilter, offset, limit int) (users []models.AdminUser, total int, err error) {
+	switch f.Status {
+	case "", UserActive, UserSuspended, UserUnverified:
+	default:
+		return nil, 0, fmt.Errorf("unknown user status %q", f.Status)
+	}
+	query := strings.ToLower(f.Query)
+
+	var matched []models.AdminUser
+	r.s.locked(func(d *memoryData) {
+		for _, u := range d.users {
+			if query != "" && !strings.Contains(strings.ToLower(u.Username), query) &&
+				!strings.Contains(strings.ToLower(u.Email), query) {
+				continue
+			}
+			if f.Role != "" && u.Role != f.Role {
+				continue
+			}
+			switch f.Status {
+			case UserActive:
+				if u.SuspendedAt != nil || u.EmailVerifiedAt == nil {
+					continue
+				}
+			case UserSuspended:
+				if u.SuspendedAt == nil {
+					continue
+				}
+			case UserUnverified:
+				if u.EmailVerifiedAt != nil {
+					continue
+				}
+			}
+			matched = append(matched, d.adminUser(u))
+		}
+	})
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	users = []models.AdminUser{}
+	if offset < len(matched) {
+		users = matched[offset:]
+		if len(users) > limit {
+			users = users[:limit]
+		}
+	}
+	return users, len(matched), nil
+}
+
+func (r memoryUsers) EmailVerified(ctx context.Context, userID int) (verified bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		u, ok := d.users[userID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		verified = u.EmailVerifiedAt != nil
+	})
+	return verified, err
+}
+
+func (r memoryUsers) UsernameTaken(ctx context.Context, username string, exceptID int) (taken bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		for id, u := range d.users {
+			if id != exceptID && u.Username == username {
+				taken = true
+				return
+			}
+		}
+	})
+	return taken, nil
+}
+
+// adminUser fills in what the administrators' view derives from other
+// tables.
+func (d *memoryData) adminUser(u models.AdminUser) models.AdminUser {
+	s, ok := d.totp[u.ID]
+	u.TwoFactorEnabled = ok && s.EnabledAt != nil
+	return u
+}
+
+func (r memoryUsers) Lock(ctx context.Context, userID int) (models.AdminUser, error) {
+	return r.Admin(ctx, userID)
+}
+
+func (r memoryUsers) FindByEmail(ctx context.Context, email string) (u models.AdminUser, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for _, candidate := range d.users {
+			if strings.EqualFold(candidate.Email, email) && (err != nil || candidate.ID < u.ID) {
+				u, err = d.adminUser(candidate), nil
+			}
+		}
+	})
+	return u, err
+}
+
+func (r memoryUsers) PasswordHash(ctx context.Context, userID int) (hash string, err error) {
+	r.s.locked(func(d *memoryData) {
+		if _, ok := d.users[userID]; !ok {
+			err = ErrNotFound
+			return
+		}
+		hash = d.passwords[userID]
+	})
+	return hash, err
+}
+
+func (r memoryUsers) EmailTaken(ctx context.Context, email string, exceptID int) (taken bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		for id, u := range d.users {
+			if id != exceptID && strings.EqualFold(u.Email, email) {
+				taken = true
+				return
+			}
+		}
+	})
+	return taken, nil
+}
+
+func (r memoryUsers) Create(ctx context.Context, nu models.NewUser) (id int, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		id = d.nextID()
+		u := models.AdminUser{ID: id, Username: nu.Username, Email: nu.Email, Role: nu.Role}
+		if nu.EmailVerified {
+			u.EmailVerifiedAt = &now
+		}
+		d.users[id] = u
+		d.passwords[id] = nu.PasswordHash
+	})
+	return id, nil
+}
+
+func (r memoryUsers) UpdateProfile(ctx context.Context, userID int, p models.ProfileUpdate) error {
+	return r.updateUser(userID, func(u *models.AdminUser) {
+		if p.Username != nil {
+			u.Username = *p.Username
+		}
+		if p.Email != nil {
+			u.Email = *p.Email
+		}
+		if p.Status != nil {
+			u.Status = *p.Status
+		}
+		if p.ResetVerification {
+			u.EmailVerifiedAt = nil
+		}
+	})
+}
+
+func (r memoryUsers) SetPassword(ctx context.Context, userID int, passwordHash string) error {
+	r.s.locked(func(d *memoryData) {
+		if _, ok := d.users[userID]; ok {
+			d.passwords[userID] = passwordHash
+		}
+	})
+	return nil
+}
+
+func (r memoryUsers) SetRole(ctx context.Context, userID int, role string) error {
+	return r.updateUser(userID, func(u *models.AdminUser) { u.Role = role })
+}
+
+func (r memoryUsers) Suspend(ctx context.Context, userID int, reason string) error {
+	now := r.s.Now()
+	return r.updateUser(userID, func(u *models.AdminUser) {
+		if u.SuspendedAt == nil {
+			u.SuspendedAt = &now
+		}
+		u.SuspendedReason = reason
+	})
+}
+
+func (r memoryUsers) Reactivate(ctx context.Context, userID int) error {
+	return r.updateUser(userID, func(u *models.AdminUser) {
+		u.SuspendedAt, u.SuspendedReason = nil, ""
+	})
+}
+
+func (r memoryUsers) VerifyEmail(ctx context.Context, userID int, email string) (alreadyVerified bool, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		u, ok := d.users[userID]
+		if !ok || u.Email != email {
+			err = ErrNotFound
+			return
+		}
+		alreadyVerified = u.EmailVerifiedAt != nil
+		if !alreadyVerified {
+			u.EmailVerifiedAt = &now
+			d.users[userID] = u
+		}
+	})
+	return alreadyVerified, err
+}
+
+func (r memoryUsers) Rename(ctx context.Context, userID int, username string) (previous string, err error) {
+	r.s.locked(func(d *memoryData) {
+		u, ok := d.users[userID]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		previous, u.Username = u.Username, username
+		d.users[userID] = u
+	})
+	return previous, err
+}
+
+// updateUser applies fn to a user; unknown users are ignored like an UPDATE
+// that matches no row.
+func (r memoryUsers) updateUser(userID int, fn func(u *models.AdminUser)) error {
+	r.s.locked(func(d *memoryData) {
+		if u, ok := d.users[userID]; ok {
+			fn(&u)
+			d.users[userID] = u
+		}
+	})
+	return nil
+}
+
+func (r memoryUsers) SetProgress(ctx context.Context, userID, progress, completedCourses int) error {
+	return r.updateUser(userID, func(u *models.AdminUser) {
+		u.Progress, u.CompletedCourses = progress, completedCourses
+	})
+}
+
+func (r memoryUsers) SetGlobalProgress(ctx context.Context, userID, progress int) error {
+	return r.updateUser(userID, func(u *models.AdminUser) { u.Progress = progress })
+}
+
+func (r memoryUsers) SetCompletedCourses(ctx context.Context, userID, completedCourses int) error {
+	return r.updateUser(userID, func(u *models.AdminUser) { u.CompletedCourses = completedCourses })
+}
+
+func (r memoryUsers) Delete(ctx context.Context, userID int) error {
+	r.s.locked(func(d *memoryData) {
+		for key := range d.completions {
+			if key[0] == userID {
+				delete(d.completions, key)
+			}
+		}
+		enrollments := d.enrollments[:0]
+		for _, e := range d.enrollments {
+			if e.userID != userID {
+				enrollments = append(enrollments, e)
+			}
+		}
+		d.enrollments = enrollments
+		bookmarks := d.bookmarks[:0]
+		for _, b := range d.bookmarks {
+			if b.userID != userID {
+				bookmarks = append(bookmarks, b)
+			}
+		}
+		d.bookmarks = bookmarks
+		activities := d.activities[:0]
+		for _, a := range d.activities {
+			if a.UserID != userID {
+				activities = append(activities, a)
+			}
+		}
+		d.activities = activities
+		tokens := d.refreshTokens[:0]
+		for _, t := range d.refreshTokens {
+			if t.UserID != userID {
+				tokens = append(tokens, t)
+			}
+		}
+		d.refreshTokens = tokens
+		delete(d.totp, userID)
+		d.removeRecoveryCodes(userID)
+		d.removeResets(userID, false)
+		delete(d.passwords, userID)
+		delete(d.users, userID)
+	})
+	return nil
+}
+
+type memorySessions struct{ s *MemoryStore }
+
+func (r memorySessions) Create(ctx context.Context, t models.RefreshToken) error {
+	r.s.locked(func(d *memoryData) {
+		t.ID = int64(d.nextID())
+		d.refreshTokens = append(d.refreshTokens, t)
+	})
+	return nil
+}
+
+func (r memorySessions) Lock(ctx context.Context, hash string) (t models.RefreshToken, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for _, candidate := range d.refreshTokens {
+			if candidate.Hash == hash {
+				t, err = candidate, nil
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+func (r memorySessions) MarkUsed(ctx context.Context, tokenID int64) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		for i := range d.refreshTokens {
+			if d.refreshTokens[i].ID == tokenID {
+				d.refreshTokens[i].UsedAt = &now
+			}
+		}
+	})
+	return nil
+}
+
+// revoke revokes the tokens matched by fn that are not revoked yet and
+// returns how many.
+func (r memorySessions) revoke(fn func(t models.RefreshToken) bool) (revoked int64) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		for i := range d.refreshTokens {
+			if t := &d.refreshTokens[i]; t.RevokedAt == nil && fn(*t) {
+				t.RevokedAt = &now
+				revoked++
+			}
+		}
+	})
+	return revoked
+}
+
+func (r memorySessions) RevokeFamily(ctx context.Context, familyID, reason string) error {
+	r.revoke(func(t models.RefreshToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+func (r memorySessions) RevokeFamilyOf(ctx context.Context, hash, reason string) error {
+	t, err := r.Lock(ctx, hash)
+	if err == ErrNotFound {
+		return nil
+	}
+	return r.RevokeFamily(ctx, t.FamilyID, reason)
+}
+
+func (r memorySessions) RevokeUser(ctx context.Context, userID int, reason string) (int64, error) {
+	return r.revoke(func(t models.RefreshToken) bool { return t.UserID == userID }), nil
+}
+
+type memoryThrottles struct{ s *MemoryStore }
+
+// throttle returns a counter as the repository reports it.
+func (d *memoryData) throttle(t models.LoginThrottle, now time.Time) models.LoginThrottle {
+	t.UserID = nil
+	if t.Scope == "account" {
+		for id, u := range d.users {
+			if strings.ToLower(u.Email) == t.Key {
+				t.UserID = &id
+				break
+			}
+		}
+	}
+	t.Locked = t.LockedUntil != nil && t.LockedUntil.After(now)
+	return t
+}
+
+func (r memoryThrottles) LockedUntil(ctx context.Context, keys []ThrottleKey) (until time.Time, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, k := range keys {
+			if t, ok := d.throttles[k]; ok && t.LockedUntil != nil && t.LockedUntil.After(until) {
+				until = *t.LockedUntil
+			}
+		}
+	})
+	return until, nil
+}
+
+func (r memoryThrottles) Hit(ctx context.Context, key ThrottleKey, window time.Duration) (failures int, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		t, ok := d.throttles[key]
+		if !ok {
+			t = models.LoginThrottle{Scope: key.Scope, Key: key.Key}
+		}
+		if t.LastFailureAt != nil && t.LastFailureAt.Before(now.Add(-window)) {
+			t.Failures = 0
+		}
+		t.Failures++
+		t.LastFailureAt = &now
+		d.throttles[key] = t
+		failures = t.Failures
+	})
+	return failures, nil
+}
+
+func (r memoryThrottles) Lock(ctx context.Context, key ThrottleKey, dur time.Duration) error {
+	until := r.s.Now().Add(dur)
+	r.s.locked(func(d *memoryData) {
+		if t, ok := d.throttles[key]; ok {
+			t.LockedUntil = &until
+			d.throttles[key] = t
+		}
+	})
+	return nil
+}
+
+func (r memoryThrottles) Get(ctx context.Context, key ThrottleKey) (t models.LoginThrottle, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		stored, ok := d.throttles[key]
+		if !ok {
+			err = ErrNotFound
+			return
+		}
+		t = d.throttle(stored, now)
+	})
+	return t, err
+}
+
+func (r memoryThrottles) Locked(ctx context.Context) ([]models.LoginThrottle, error) {
+	now := r.s.Now()
+	throttles := []models.LoginThrottle{}
+	r.s.locked(func(d *memoryData) {
+		for _, t := range d.throttles {
+			if t = d.throttle(t, now); t.Locked {
+				throttles = append(throttles, t)
+			}
+		}
+	})
+	sort.Slice(throttles, func(i, j int) bool { return throttles[i].LockedUntil.After(*throttles[j].LockedUntil) })
+	return throttles, nil
+}
+
+func (r memoryThrottles) Clear(ctx context.Context, key ThrottleKey) (t models.LoginThrottle, err error) {
+	r.s.locked(func(d *memoryData) {
+		var ok bool
+		if t, ok = d.throttles[key]; !ok {
+			err = ErrNotFound
+			return
+		}
+		delete(d.throttles, key)
+	})
+	return t, err
+}
+
+type memoryRecoveryCode struct {
+	userID int
+	hash   string
+	used   bool
+}
+
+type memoryTwoFactor struct{ s *MemoryStore }
+
+func (r memoryTwoFactor) Enabled(ctx context.Context, userID int) (enabled bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		s, ok := d.totp[userID]
+		enabled = ok && s.EnabledAt != nil
+	})
+	return enabled, nil
+}
+
+func (r memoryTwoFactor) RecoveryCodesLeft(ctx context.Context, userID int) (left int, err error) {
+	r.s.locked(func(d *memoryData) {
+		for _, c := range d.recoveryCodes {
+			if c.userID == userID && !c.used {
+				left++
+			}
+		}
+	})
+	return left, nil
+}
+
+func (r memoryTwoFactor) SetPending(ctx context.Context, userID int, secret string) error {
+	r.s.locked(func(d *memoryData) {
+		if s, ok := d.totp[userID]; ok && s.EnabledAt != nil {
+			return
+		}
+		d.totp[userID] = models.TOTPSecret{UserID: userID, Secret: secret}
+	})
+	return nil
+}
+
+func (r memoryTwoFactor) Lock(ctx context.Context, userID int) (s models.TOTPSecret, err error) {
+	r.s.locked(func(d *memoryData) {
+		var ok bool
+		if s, ok = d.totp[userID]; !ok {
+			err = ErrNotFound
+		}
+	})
+	return s, err
+}
+
+func (r memoryTwoFactor) Enable(ctx context.Context, userID int, step int64) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		if s, ok := d.totp[userID]; ok {
+			s.EnabledAt, s.LastUsedStep = &now, step
+			d.totp[userID] = s
+		}
+	})
+	return nil
+}
+
+func (r memoryTwoFactor) SetLastStep(ctx context.Context, userID int, step int64) error {
+	r.s.locked(func(d *memoryData) {
+		if s, ok := d.totp[userID]; ok {
+			s.LastUsedStep = step
+			d.totp[userID] = s
+		}
+	})
+	return nil
+}
+
+func (r memoryTwoFactor) UseRecoveryCode(ctx context.Context, userID int, hash string) (found bool, err error) {
+	r.s.locked(func(d *memoryData) {
+		for i := range d.recoveryCodes {
+			if c := &d.recoveryCodes[i]; c.userID == userID && c.hash == hash && !c.used {
+				c.used, found = true, true
+				return
+			}
+		}
+	})
+	return found, nil
+}
+
+func (r memoryTwoFactor) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	r.s.locked(func(d *memoryData) {
+		d.removeRecoveryCodes(userID)
+		for _, hash := range hashes {
+			d.recoveryCodes = append(d.recoveryCodes, memoryRecoveryCode{userID: userID, hash: hash})
+		}
+	})
+	return nil
+}
+
+func (d *memoryData) removeRecoveryCodes(userID int) {
+	codes := d.recoveryCodes[:0]
+	for _, c := range d.recoveryCodes {
+		if c.userID != userID {
+			codes = append(codes, c)
+		}
+	}
+	d.recoveryCodes = codes
+}
+
+func (r memoryTwoFactor) Disable(ctx context.Context, userID int) error {
+	r.s.locked(func(d *memoryData) {
+		delete(d.totp, userID)
+		d.removeRecoveryCodes(userID)
+	})
+	return nil
+}
+
+type memoryPasswordResets struct{ s *MemoryStore }
+
+// removeResets drops the user's reset tokens, or only the unused ones.
+func (d *memoryData) removeResets(userID int, unusedOnly bool) {
+	resets := d.resets[:0]
+	for _, t := range d.resets {
+		if t.UserID != userID || (unusedOnly && t.UsedAt != nil) {
+			resets = append(resets, t)
+		}
+	}
+	d.resets = resets
+}
+
+func (r memoryPasswordResets) Replace(ctx context.Context, t models.PasswordReset) error {
+	r.s.locked(func(d *memoryData) {
+		d.removeResets(t.UserID, true)
+		t.ID = int64(d.nextID())
+		d.resets = append(d.resets, t)
+	})
+	return nil
+}
+
+func (r memoryPasswordResets) Lock(ctx context.Context, hash string) (t models.PasswordReset, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for _, candidate := range d.resets {
+			if candidate.Hash == hash {
+				t, err = candidate, nil
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+func (r memoryPasswordResets) Redeem(ctx context.Context, t models.PasswordReset) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		for i := range d.resets {
+			if d.resets[i].ID == t.ID {
+				d.resets[i].UsedAt = &now
+			}
+		}
+		d.removeResets(t.UserID, true)
+	})
+	return nil
+}
+
+func (r memoryPasswordResets) DiscardUnused(ctx context.Context, userID int) error {
+	r.s.locked(func(d *memoryData) { d.removeResets(userID, true) })
+	return nil
+}
+
+type memoryTemplates struct{ s *MemoryStore }
+
+func (r memoryTemplates) Get(ctx context.Context, templateID int) (t models.CourseTemplate, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for _, candidate := range d.templates {
+			if candidate.ID == templateID {
+				t, err = candidate, nil
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+func (r memoryTemplates) ForLevel(ctx context.Context, level string) (t models.CourseTemplate, err error) {
+	level = strings.ToLower(level)
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		// Templates are appended with increasing IDs, so the first match is
+		// the oldest.
+		for _, candidate := range d.templates {
+			if candidate.Level == level {
+				t, err = candidate, nil
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+func (r memoryTemplates) List(ctx context.Context) (templates []models.CourseTemplate, err error) {
+	r.s.locked(func(d *memoryData) {
+		templates = append([]models.CourseTemplate{}, d.templates...)
+	})
+	sort.SliceStable(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (r memoryTemplates) Create(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error) {
+	r.s.locked(func(d *memoryData) {
+		t.ID = d.nextID()
+		d.templates = append(d.templates, t)
+	})
+	return t, nil
+}
+
+func (r memoryTemplates) Update(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error) {
+	err := ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for i := range d.templates {
+			if d.templates[i].ID == t.ID {
+				d.templates[i], err = t, nil
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+func (r memoryTemplates) Delete(ctx context.Context, templateID int) (t models.CourseTemplate, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for i, candidate := range d.templates {
+			if candidate.ID == templateID {
+				t, err = candidate, nil
+				d.templates = append(d.templates[:i:i], d.templates[i+1:]...)
+				return
+			}
+		}
+	})
+	return t, err
+}
+
+type memoryAudit struct{ s *MemoryStore }
+
+func (f AuditFilter) matches(e memoryAuditEntry) bool {
+	if f.ActorID != nil && (e.ActorID == nil || *e.ActorID != *f.ActorID) {
+		return false
+	}
+	if f.Action != "" {
+		if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+			if !strings.HasPrefix(e.Action, prefix) {
+				return false
+			}
+		} else if e.Action != f.Action {
+			return false
+		}
+	}
+	switch {
+	case f.TargetType != "" && e.TargetType != f.TargetType,
+		f.TargetID != "" && e.TargetID != f.TargetID,
+		f.RequestID != "" && e.RequestID != f.RequestID,
+		!f.From.IsZero() && e.occurredAt.Before(f.From),
+		!f.To.IsZero() && !e.occurredAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+func (r memoryAudit) Record(ctx context.Context, e models.AuditEntry) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		e.ID = int64(d.nextID())
+		e.OccurredAt = formatTime(&now)
+		d.audit = append(d.audit, memoryAuditEntry{AuditEntry: e, occurredAt: now})
+	})
+	return nil
+}
+
+// matching returns the entries matching f, oldest first.
+func (r memoryAudit) matching(f AuditFilter) []models.AuditEntry {
+	var entries []models.AuditEntry
+	r.s.locked(func(d *memoryData) {
+		for _, e := range d.audit {
+			if f.matches(e) {
+				entries = append(entries, e.AuditEntry)
+			}
+		}
+	})
+	return entries
+}
+
+func (r memoryAudit) Count(ctx context.Context, f AuditFilter) (int, error) {
+	return len(r.matching(f)), nil
+}
+
+func (r memoryAudit) List(ctx context.Context, f AuditFilter, offset, limit int) ([]models.AuditEntry, error) {
+	matched := r.matching(f)
+	entries := []models.AuditEntry{}
+	for i := len(matched) - 1 - offset; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, matched[i])
+	}
+	return entries, nil
+}
+
+func (r memoryAudit) After(ctx context.Context, f AuditFilter, afterID int64, limit int) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	for _, e := range r.matching(f) {
+		if e.ID > afterID && len(entries) < limit {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+type memoryMaintenance struct{ s *MemoryStore }
+
+func (r memoryMaintenance) Start(ctx context.Context, job string, actorID int, dryRun bool) (runID int64, err error) {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		run := models.MaintenanceRun{
+			ID: int64(d.nextID()), Job: job, DryRun: dryRun, Status: models.RunRunning,
+			StartedAt: formatTime(&now),
+		}
+		if actorID != 0 {
+			run.ActorID = &actorID
+		}
+		d.runs = append(d.runs, memoryRun{MaintenanceRun: run, startedAt: now})
+		runID = run.ID
+	})
+	return runID, nil
+}
+
+func (r memoryMaintenance) Finish(ctx context.Context, runID int64, status string, summary []byte, errText string) error {
+	now := r.s.Now()
+	r.s.locked(func(d *memoryData) {
+		for i := range d.runs {
+			if run := &d.runs[i]; run.ID == runID {
+				run.Status, run.FinishedAt, run.Error = status, formatTime(&now), errText
+				run.Summary = json.RawMessage(summary)
+			}
+		}
+	})
+	return nil
+}
+
+func (r memoryMaintenance) List(ctx context.Context, job, status string, limit int) ([]models.MaintenanceRun, error) {
+	var runs []memoryRun
+	r.s.locked(func(d *memoryData) {
+		for _, run := range d.runs {
+			if (job == "" || run.Job == job) && (status == "" || run.Status == status) {
+				runs = append(runs, run)
+			}
+		}
+	})
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].startedAt.Equal(runs[j].startedAt) {
+			return runs[i].startedAt.After(runs[j].startedAt)
+		}
+		return runs[i].ID > runs[j].ID
+	})
+
+	list := []models.MaintenanceRun{}
+	for _, run := range runs {
+		if len(list) == limit {
+			break
+		}
+		run.Summary = nil
+		list = append(list, run.MaintenanceRun)
+	}
+	return list, nil
+}
+
+func (r memoryMaintenance) Get(ctx context.Context, runID int64) (run models.MaintenanceRun, err error) {
+	err = ErrNotFound
+	r.s.locked(func(d *memoryData) {
+		for _, candidate := range d.runs {
+			if candidate.ID == runID {
+				run, err = candidate.MaintenanceRun, nil
+				return
+			}
+		}
+	})
+	return run, err
+}
+
+// LockJob always succeeds: transactions are serialised, so no other run can
+// hold the lock.
+func (r memoryMaintenance) LockJob(ctx context.Context, job string) error {
+	return nil
+}
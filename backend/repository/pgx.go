@@ -0,0 +1,1613 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// PgxStore is the Postgres Store.
+type PgxStore struct {
+	q querier
+	// pool is nil inside a transaction.
+	pool *pgxpool.Pool
+}
+
+var _ Store = (*PgxStore)(nil)
+
+func NewPgxStore(pool *pgxpool.Pool) *PgxStore {
+	return &PgxStore{q: pool, pool: pool}
+}
+
+// NewPgxTxStore returns a Store that runs on a transaction the caller began
+// and will commit, for code that mixes repositories with its own queries.
+func NewPgxTxStore(tx pgx.Tx) *PgxStore {
+	return &PgxStore{q: tx}
+}
+
+func (s *PgxStore) Courses() CourseRepository               { return pgxCourses{s.q} }
+func (s *PgxStore) Modules() ModuleRepository               { return pgxModules{s.q} }
+func (s *PgxStore) Enrollments() EnrollmentRepository       { return pgxEnrollments{s.q} }
+func (s *PgxStore) Bookmarks() BookmarkRepository           { return pgxBookmarks{s.q} }
+func (s *PgxStore) Activities() ActivityRepository          { return pgxActivities{s.q} }
+func (s *PgxStore) Users() UserRepository                   { return pgxUsers{s.q} }
+func (s *PgxStore) Sessions() SessionRepository             { return pgxSessions{s.q} }
+func (s *PgxStore) Throttles() ThrottleRepository           { return pgxThrottles{s.q} }
+func (s *PgxStore) TwoFactor() TwoFactorRepository          { return pgxTwoFactor{s.q} }
+func (s *PgxStore) PasswordResets() PasswordResetRepository { return pgxPasswordResets{s.q} }
+func (s *PgxStore) Templates() TemplateRepository           { return pgxTemplates{s.q} }
+func (s *PgxStore) Audit() AuditRepository                  { return pgxAudit{s.q} }
+func (s *PgxStore) Maintenance() MaintenanceRepository      { return pgxMaintenance{s.q} }
+
+// WithTx runs fn in a transaction. Nested calls join the outer transaction.
+func (s *PgxStore) WithTx(ctx context.Context, fn func(Store) error) error {
+	if s.pool == nil {
+		return fn(s)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&PgxStore{q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Per-course module counts for the user bound to $1, meant to be embedded in
+// a SELECT over "courses c". Completions are only counted for modules that
+// still belong to the course, so dangling rows never inflate progress.
+const (
+	totalModulesSQL = `(SELECT COUNT(*) FROM course_modules m WHERE m.course_id = c.id)`
+
+	completedModulesSQL = `(SELECT COUNT(*) FROM completed_modules cm
+		JOIN course_modules m ON m.id = cm.module_id AND m.course_id = cm.course_id
+		WHERE cm.user_id = $1 AND cm.course_id = c.id)`
+)
+
+type pgxCourses struct{ q querier }
+
+func (r pgxCourses) Exists(ctx context.Context, courseID int) (bool, error) {
+	var exists bool
+	err := r.q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM courses WHERE id = $1 AND archived_at IS NULL)", courseID).Scan(&exists)
+	return exists, err
+}
+
+func (r pgxCourses) Title(ctx context.Context, courseID int) (string, error) {
+	var title string
+	err := r.q.QueryRow(ctx, "SELECT title FROM courses WHERE id = $1", courseID).Scan(&title)
+	return title, notFound(err)
+}
+
+const courseColumns = `id, title, description, COALESCE(level, ''), COALESCE(duration, ''),
+	COALESCE(instructor, ''), COALESCE(video_url, ''), owner_id, archived_at, archived_by`
+
+func scanCourse(row pgx.Row) (models.Course, error) {
+	var c models.Course
+	err := row.Scan(&c.ID, &c.Title, &c.Description, &c.Level, &c.Duration, &c.Instructor,
+		&c.VideoUrl, &c.OwnerID, &c.ArchivedAt, &c.ArchivedBy)
+	return c, notFound(err)
+}
+
+func (r pgxCourses) Find(ctx context.Context, courseID int) (models.Course, error) {
+	return scanCourse(r.q.QueryRow(ctx, "SELECT "+courseColumns+" FROM courses WHERE id = $1", courseID))
+}
+
+func (r pgxCourses) Lock(ctx context.Context, courseID int) (models.Course, error) {
+	return scanCourse(r.q.QueryRow(ctx,
+		"SELECT "+courseColumns+" FROM courses WHERE id = $1 FOR UPDATE", courseID))
+}
+
+// learnerCourseSQL selects the courses that are not archived as the user
+// bound to $1 sees them. Callers append conditions and the order.
+const learnerCourseSQL = `
+	SELECT c.id, c.title, c.description, COALESCE(c.level, ''), COALESCE(c.duration, ''),
+		COALESCE(c.instructor, ''), COALESCE(c.video_url, ''),
+		CASE WHEN uc.user_id IS NOT NULL AND uc.status <> 'dropped' THEN true ELSE false END,
+		CASE WHEN b.user_id IS NOT NULL THEN true ELSE false END,
+		CASE WHEN uc.completed IS TRUE THEN true ELSE false END,
+		COALESCE(uc.status, ''),
+		` + totalModulesSQL + `, ` + completedModulesSQL + `
+	FROM courses c
+	LEFT JOIN user_courses uc ON c.id = uc.course_id AND uc.user_id = $1
+	LEFT JOIN user_bookmarks b ON c.id = b.course_id AND b.user_id = $1
+	WHERE c.archived_at IS NULL`
+
+func scanLearnerCourse(row pgx.Row) (models.LearnerCourse, error) {
+	var c models.LearnerCourse
+	err := row.Scan(&c.ID, &c.Title, &c.Description, &c.Level, &c.Duration, &c.Instructor, &c.VideoUrl,
+		&c.Enrolled, &c.Bookmarked, &c.Completed, &c.EnrollmentStatus, &c.TotalModules, &c.CompletedModules)
+	return c, err
+}
+
+func (r pgxCourses) learnerCourses(ctx context.Context, sql string, args ...any) ([]models.LearnerCourse, error) {
+	rows, err := r.q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []models.LearnerCourse
+	for rows.Next() {
+		c, err := scanLearnerCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+func (r pgxCourses) List(ctx context.Context, userID int) ([]models.LearnerCourse, error) {
+	return r.learnerCourses(ctx, learnerCourseSQL+" ORDER BY c.id", userID)
+}
+
+func (r pgxCourses) Search(ctx context.Context, userID int, query string, limit int) ([]models.LearnerCourse, error) {
+	return r.learnerCourses(ctx, learnerCourseSQL+`
+			AND (c.title ILIKE $2 OR c.description ILIKE $2)
+		ORDER BY
+			CASE WHEN c.title ILIKE $3 THEN 0 ELSE 1 END,
+			CASE WHEN c.title ILIKE $2 THEN 0 ELSE 1 END,
+			c.title
+		LIMIT $4
+	`, userID, "%"+query+"%", query+"%", limit)
+}
+
+func (r pgxCourses) Get(ctx context.Context, userID, courseID int) (models.LearnerCourse, error) {
+	c, err := scanLearnerCourse(r.q.QueryRow(ctx, learnerCourseSQL+" AND c.id = $2", userID, courseID))
+	return c, notFound(err)
+}
+
+func (r pgxCourses) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.q.QueryRow(ctx, "SELECT COUNT(*) FROM courses WHERE archived_at IS NULL").Scan(&count)
+	return count, err
+}
+
+func (r pgxCourses) Page(ctx context.Context, offset, limit int) ([]models.Course, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT `+courseColumns+`
+		FROM courses
+		WHERE archived_at IS NULL
+		ORDER BY id
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []models.Course
+	for rows.Next() {
+		c, err := scanCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+func (r pgxCourses) Create(ctx context.Context, c models.Course) (int, error) {
+	var id int
+	err := r.q.QueryRow(ctx, `
+		INSERT INTO courses (title, description, level, duration, instructor, video_url, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, c.Title, c.Description, c.Level, c.Duration, c.Instructor, c.VideoUrl, c.OwnerID).Scan(&id)
+	return id, err
+}
+
+func (r pgxCourses) Update(ctx context.Context, c models.Course) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE courses
+		SET title = $2, description = $3, level = $4, duration = $5, instructor = $6, video_url = $7
+		WHERE id = $1
+	`, c.ID, c.Title, c.Description, c.Level, c.Duration, c.Instructor, c.VideoUrl)
+	return err
+}
+
+func (r pgxCourses) Archive(ctx context.Context, courseID, by int) (time.Time, error) {
+	var archivedAt time.Time
+	err := r.q.QueryRow(ctx, `
+		UPDATE courses SET archived_at = NOW(), archived_by = $2
+		WHERE id = $1
+		RETURNING archived_at
+	`, courseID, by).Scan(&archivedAt)
+	return archivedAt, notFound(err)
+}
+
+func (r pgxCourses) Restore(ctx context.Context, courseID int) error {
+	_, err := r.q.Exec(ctx, "UPDATE courses SET archived_at = NULL, archived_by = NULL WHERE id = $1", courseID)
+	return err
+}
+
+func (r pgxCourses) Archived(ctx context.Context, ownerID int) ([]models.Course, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT `+courseColumns+`
+		FROM courses
+		WHERE archived_at IS NOT NULL AND ($1 = 0 OR owner_id = $1)
+		ORDER BY archived_at DESC
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []models.Course{}
+	for rows.Next() {
+		c, err := scanCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+func (r pgxCourses) ArchivedBefore(ctx context.Context, cutoff time.Time) ([]int, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT id FROM courses
+		WHERE archived_at < $1
+		ORDER BY id
+		FOR UPDATE
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// courseOwnedTables lists the tables whose rows are removed with a course
+// when it is purged, children first.
+var courseOwnedTables = []string{
+	"completed_modules",
+	"course_modules",
+	"user_courses",
+	"user_bookmarks",
+	"user_activities",
+}
+
+func (r pgxCourses) Purge(ctx context.Context, courseID int) error {
+	for _, table := range courseOwnedTables {
+		if _, err := r.q.Exec(ctx, "DELETE FROM "+table+" WHERE course_id = $1", courseID); err != nil {
+			return err
+		}
+	}
+	_, err := r.q.Exec(ctx, "DELETE FROM courses WHERE id = $1", courseID)
+	return err
+}
+
+type pgxModules struct{ q querier }
+
+// moduleColumns is the column list scanModule expects.
+const moduleColumns = `id, course_id, title, COALESCE(description, ''), COALESCE(content, ''),
+	COALESCE(video_url, ''), COALESCE(module_order, 0), auto_generated`
+
+func scanModule(row pgx.Row) (models.CourseModule, error) {
+	var m models.CourseModule
+	err := row.Scan(&m.ID, &m.CourseID, &m.Title, &m.Description, &m.Content, &m.VideoUrl, &m.Order, &m.AutoGenerated)
+	return m, err
+}
+
+func (r pgxModules) modules(ctx context.Context, sql string, args ...any) ([]models.CourseModule, error) {
+	rows, err := r.q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modules := []models.CourseModule{}
+	for rows.Next() {
+		m, err := scanModule(rows)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, rows.Err()
+}
+
+func (r pgxModules) ForCourse(ctx context.Context, courseID int) ([]models.CourseModule, error) {
+	return r.modules(ctx, `
+		SELECT `+moduleColumns+`
+		FROM course_modules
+		WHERE course_id = $1
+		ORDER BY module_order NULLS LAST, id
+	`, courseID)
+}
+
+func (r pgxModules) Lock(ctx context.Context, courseID int) ([]models.CourseModule, error) {
+	return r.modules(ctx, `
+		SELECT `+moduleColumns+`
+		FROM course_modules
+		WHERE course_id = $1
+		ORDER BY module_order NULLS LAST, id
+		FOR UPDATE
+	`, courseID)
+}
+
+func (r pgxModules) Count(ctx context.Context, courseID int) (int, error) {
+	var count int
+	err := r.q.QueryRow(ctx,
+		"SELECT COUNT(*) FROM course_modules WHERE course_id = $1", courseID).Scan(&count)
+	return count, err
+}
+
+func (r pgxModules) Get(ctx context.Context, courseID, moduleID int) (models.CourseModule, error) {
+	m, err := scanModule(r.q.QueryRow(ctx,
+		"SELECT "+moduleColumns+" FROM course_modules WHERE id = $1 AND course_id = $2", moduleID, courseID))
+	return m, notFound(err)
+}
+
+func (r pgxModules) Create(ctx context.Context, m models.CourseModule) (int, error) {
+	var id int
+	err := r.q.QueryRow(ctx, `
+		INSERT INTO course_modules (course_id, title, description, content, video_url, module_order)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, m.CourseID, m.Title, m.Description, m.Content, m.VideoUrl, m.Order).Scan(&id)
+	return id, err
+}
+
+func (r pgxModules) Update(ctx context.Context, m models.CourseModule) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE course_modules
+		SET title = $1, description = $2, content = $3, video_url = $4, module_order = $5
+		WHERE id = $6 AND course_id = $7
+	`, m.Title, m.Description, m.Content, m.VideoUrl, m.Order, m.ID, m.CourseID)
+	return err
+}
+
+func (r pgxModules) SetAutoGenerated(ctx context.Context, moduleID int, autoGenerated bool) error {
+	_, err := r.q.Exec(ctx, "UPDATE course_modules SET auto_generated = $2 WHERE id = $1", moduleID, autoGenerated)
+	return err
+}
+
+func (r pgxModules) AutoGenerated(ctx context.Context) ([]models.AutoGeneratedModule, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT cm.id, cm.course_id, COALESCE(c.title, ''), cm.title,
+			(SELECT COUNT(*) FROM completed_modules WHERE module_id = cm.id) AS completions
+		FROM course_modules cm
+		LEFT JOIN courses c ON c.id = cm.course_id
+		WHERE cm.auto_generated
+		ORDER BY cm.course_id, cm.module_order, cm.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modules := []models.AutoGeneratedModule{}
+	for rows.Next() {
+		var m models.AutoGeneratedModule
+		if err := rows.Scan(&m.ID, &m.CourseID, &m.CourseTitle, &m.Title, &m.Completions); err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, rows.Err()
+}
+
+func (r pgxModules) Dangling(ctx context.Context) ([]models.DanglingCompletion, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT cm.user_id, cm.course_id, cm.module_id, cm.completed_at,
+			CASE
+				WHEN m.id IS NULL THEN $1::text
+				WHEN m.course_id IS DISTINCT FROM cm.course_id THEN $2
+				ELSE $3
+			END AS reason,
+			m.course_id
+		FROM completed_modules cm
+		LEFT JOIN course_modules m ON m.id = cm.module_id
+		WHERE m.id IS NULL
+			OR m.course_id IS DISTINCT FROM cm.course_id
+			OR m.auto_generated
+		ORDER BY cm.course_id, cm.module_id, cm.user_id
+	`, models.DanglingModuleMissing, models.DanglingCourseMismatch, models.DanglingAutoGenerated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dangling := []models.DanglingCompletion{}
+	for rows.Next() {
+		var c models.DanglingCompletion
+		if err := rows.Scan(&c.UserID, &c.CourseID, &c.ModuleID, &c.CompletedAt, &c.Reason, &c.ModuleCourseID); err != nil {
+			return nil, err
+		}
+		dangling = append(dangling, c)
+	}
+	return dangling, rows.Err()
+}
+
+func (r pgxModules) Delete(ctx context.Context, courseID int, moduleIDs []int) (int64, error) {
+	tag, err := r.q.Exec(ctx,
+		"DELETE FROM completed_modules WHERE course_id = $1 AND module_id = ANY($2)", courseID, moduleIDs)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.q.Exec(ctx,
+		"DELETE FROM course_modules WHERE course_id = $1 AND id = ANY($2)", courseID, moduleIDs)
+	return tag.RowsAffected(), err
+}
+
+func (r pgxModules) Renumber(ctx context.Context, courseID int) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE course_modules cm
+		SET module_order = o.position
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY module_order NULLS LAST, id) AS position
+			FROM course_modules
+			WHERE course_id = $1
+		) o
+		WHERE cm.id = o.id AND cm.module_order IS DISTINCT FROM o.position
+	`, courseID)
+	return err
+}
+
+func (r pgxModules) Duplicates(ctx context.Context) ([]models.DuplicateModule, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT d.course_id, d.id, d.title, d.survivor_id,
+			(SELECT COUNT(*) FROM completed_modules WHERE module_id = d.id)::int
+		FROM (
+			SELECT id, course_id, title,
+				FIRST_VALUE(id) OVER (
+					PARTITION BY course_id, title
+					ORDER BY module_order NULLS LAST, id
+				) AS survivor_id
+			FROM course_modules
+		) d
+		WHERE d.id <> d.survivor_id
+		ORDER BY d.course_id, d.survivor_id, d.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dups := []models.DuplicateModule{}
+	for rows.Next() {
+		var d models.DuplicateModule
+		if err := rows.Scan(&d.CourseID, &d.ModuleID, &d.Title, &d.SurvivorID, &d.Completions); err != nil {
+			return nil, err
+		}
+		dups = append(dups, d)
+	}
+	return dups, rows.Err()
+}
+
+func (r pgxModules) Merge(ctx context.Context, duplicates []models.DuplicateModule) error {
+	duplicateIDs := make([]int, len(duplicates))
+	survivorIDs := make([]int, len(duplicates))
+	for i, d := range duplicates {
+		duplicateIDs[i], survivorIDs[i] = d.ModuleID, d.SurvivorID
+	}
+
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO completed_modules (user_id, course_id, module_id, completed_at)
+		SELECT cm.user_id, m.course_id, d.survivor_id, MIN(cm.completed_at)
+		FROM completed_modules cm
+		JOIN unnest($1::int[], $2::int[]) AS d(duplicate_id, survivor_id) ON d.duplicate_id = cm.module_id
+		JOIN course_modules m ON m.id = d.survivor_id
+		GROUP BY cm.user_id, m.course_id, d.survivor_id
+		ON CONFLICT (user_id, module_id) DO UPDATE
+		SET completed_at = LEAST(completed_modules.completed_at, EXCLUDED.completed_at)
+	`, duplicateIDs, survivorIDs)
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.q.Exec(ctx, "DELETE FROM completed_modules WHERE module_id = ANY($1)", duplicateIDs); err != nil {
+		return err
+	}
+	_, err = r.q.Exec(ctx, "DELETE FROM course_modules WHERE id = ANY($1)", duplicateIDs)
+	return err
+}
+
+func (r pgxModules) Completed(ctx context.Context, userID, courseID int) (map[int]bool, error) {
+	rows, err := r.q.Query(ctx,
+		"SELECT module_id FROM completed_modules WHERE user_id = $1 AND course_id = $2", userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := map[int]bool{}
+	for rows.Next() {
+		var moduleID int
+		if err := rows.Scan(&moduleID); err != nil {
+			return nil, err
+		}
+		completed[moduleID] = true
+	}
+	return completed, rows.Err()
+}
+
+func (r pgxModules) CourseID(ctx context.Context, moduleID int) (int, error) {
+	var courseID *int
+	err := r.q.QueryRow(ctx, "SELECT course_id FROM course_modules WHERE id = $1", moduleID).Scan(&courseID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+	if courseID == nil {
+		return 0, ErrNotFound
+	}
+	return *courseID, nil
+}
+
+func (r pgxModules) Complete(ctx context.Context, userID, courseID, moduleID int) error {
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO completed_modules (user_id, course_id, module_id, completed_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, module_id) DO NOTHING
+	`, userID, courseID, moduleID)
+	return err
+}
+
+func (r pgxModules) Uncomplete(ctx context.Context, userID, moduleID int) error {
+	_, err := r.q.Exec(ctx,
+		"DELETE FROM completed_modules WHERE user_id = $1 AND module_id = $2", userID, moduleID)
+	return err
+}
+
+func (r pgxModules) Progress(ctx context.Context, userID, courseID int) (completed, total int, err error) {
+	err = r.q.QueryRow(ctx, `
+		SELECT `+totalModulesSQL+`, `+completedModulesSQL+`
+		FROM courses c
+		WHERE c.id = $2
+	`, userID, courseID).Scan(&total, &completed)
+	return completed, total, notFound(err)
+}
+
+type pgxEnrollments struct{ q querier }
+
+func (r pgxEnrollments) Status(ctx context.Context, userID, courseID int) (string, error) {
+	var status string
+	err := r.q.QueryRow(ctx, `
+		SELECT status FROM user_courses
+		WHERE user_id = $1 AND course_id = $2
+		ORDER BY id
+		LIMIT 1
+	`, userID, courseID).Scan(&status)
+	return status, notFound(err)
+}
+
+func (r pgxEnrollments) Get(ctx context.Context, userID, courseID int) (models.UserCourse, error) {
+	e := models.UserCourse{UserID: userID, CourseID: courseID}
+	var enrolledAt, statusChangedAt, pausedAt, droppedAt, completedAt *time.Time
+	err := r.q.QueryRow(ctx, `
+		SELECT id, COALESCE(completed, false), status, enrolled_at, status_changed_at,
+			paused_at, dropped_at, completed_at
+		FROM user_courses
+		WHERE user_id = $1 AND course_id = $2
+		ORDER BY id
+		LIMIT 1
+	`, userID, courseID).Scan(&e.ID, &e.Completed, &e.Status, &enrolledAt, &statusChangedAt,
+		&pausedAt, &droppedAt, &completedAt)
+	if err != nil {
+		return e, notFound(err)
+	}
+	e.EnrolledAt = formatTime(enrolledAt)
+	e.StatusChangedAt = formatTime(statusChangedAt)
+	e.PausedAt = formatTime(pausedAt)
+	e.DroppedAt = formatTime(droppedAt)
+	e.CompletedAt = formatTime(completedAt)
+	return e, nil
+}
+
+// lock reads the enrollment's id and status and locks the row for the rest
+// of the transaction.
+func (r pgxEnrollments) lock(ctx context.Context, userID, courseID int) (id int, status string, err error) {
+	err = r.q.QueryRow(ctx, `
+		SELECT id, status FROM user_courses
+		WHERE user_id = $1 AND course_id = $2
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE
+	`, userID, courseID).Scan(&id, &status)
+	return id, status, err
+}
+
+func (r pgxEnrollments) Transition(ctx context.Context, userID, courseID int, target string) (string, error) {
+	id, from, err := r.lock(ctx, userID, courseID)
+	if errors.Is(err, pgx.ErrNoRows) && target == models.EnrollmentActive {
+		tag, err := r.q.Exec(ctx, `
+			INSERT INTO user_courses (user_id, course_id, status, enrolled_at, status_changed_at)
+			VALUES ($1, $2, $3, NOW(), NOW())
+			ON CONFLICT (user_id, course_id) DO NOTHING
+		`, userID, courseID, models.EnrollmentActive)
+		if err != nil || tag.RowsAffected() > 0 {
+			return "", err
+		}
+		// A concurrent request enrolled first; carry on from its row.
+		id, from, err = r.lock(ctx, userID, courseID)
+		if err != nil {
+			return "", notFound(err)
+		}
+	} else if err != nil {
+		return "", notFound(err)
+	}
+
+	if change, err := transitionChanges(from, target); !change {
+		return from, err
+	}
+	_, err = r.q.Exec(ctx, `
+		UPDATE user_courses SET
+			status = $1,
+			status_changed_at = NOW(),
+			paused_at = CASE WHEN $1 = 'paused' THEN NOW() ELSE paused_at END,
+			dropped_at = CASE WHEN $1 = 'dropped' THEN NOW() ELSE dropped_at END
+		WHERE id = $2
+	`, target, id)
+	return from, err
+}
+
+func (r pgxEnrollments) MarkCompleted(ctx context.Context, userID, courseID int) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE user_courses SET completed = true, completed_at = NOW(),
+			status = $3, status_changed_at = NOW()
+		WHERE user_id = $1 AND course_id = $2 AND completed IS NOT TRUE
+	`, userID, courseID, models.EnrollmentCompleted)
+	return err
+}
+
+func (r pgxEnrollments) Reopen(ctx context.Context, userID, courseID int) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE user_courses SET completed = false, completed_at = NULL,
+			status = $3, status_changed_at = NOW()
+		WHERE user_id = $1 AND course_id = $2 AND completed IS TRUE
+	`, userID, courseID, models.EnrollmentActive)
+	return err
+}
+
+func (r pgxEnrollments) CountCompleted(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.q.QueryRow(ctx,
+		"SELECT COUNT(*) FROM user_courses WHERE user_id = $1 AND completed = true", userID).Scan(&count)
+	return count, err
+}
+
+func (r pgxEnrollments) ModuleTotals(ctx context.Context, userID int) (completed, total int, err error) {
+	err = r.q.QueryRow(ctx, `
+		SELECT COALESCE(SUM(`+totalModulesSQL+`), 0)::int,
+			COALESCE(SUM(`+completedModulesSQL+`), 0)::int
+		FROM user_courses uc
+		JOIN courses c ON c.id = uc.course_id
+		WHERE uc.user_id = $1 AND uc.status <> $2 AND c.archived_at IS NULL
+	`, userID, models.EnrollmentDropped).Scan(&total, &completed)
+	return completed, total, err
+}
+
+type pgxBookmarks struct{ q querier }
+
+func (r pgxBookmarks) Exists(ctx context.Context, userID, courseID int) (bool, error) {
+	var exists bool
+	err := r.q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM user_bookmarks WHERE user_id = $1 AND course_id = $2)",
+		userID, courseID).Scan(&exists)
+	return exists, err
+}
+
+func (r pgxBookmarks) Add(ctx context.Context, userID, courseID int) error {
+	_, err := r.q.Exec(ctx,
+		"INSERT INTO user_bookmarks (user_id, course_id) VALUES ($1, $2)", userID, courseID)
+	return err
+}
+
+func (r pgxBookmarks) Remove(ctx context.Context, userID, courseID int) error {
+	_, err := r.q.Exec(ctx,
+		"DELETE FROM user_bookmarks WHERE user_id = $1 AND course_id = $2", userID, courseID)
+	return err
+}
+
+func (r pgxBookmarks) Courses(ctx context.Context, userID int) ([]models.BookmarkedCourse, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT c.id, c.title, c.description, COALESCE(c.level, ''), COALESCE(c.duration, ''),
+			COALESCE(c.instructor, ''), COALESCE(c.video_url, ''),
+			CASE WHEN uc.user_id IS NOT NULL AND uc.status <> 'dropped' THEN true ELSE false END,
+			CASE WHEN uc.completed IS TRUE THEN true ELSE false END,
+			`+totalModulesSQL+`, `+completedModulesSQL+`
+		FROM courses c
+		JOIN user_bookmarks b ON c.id = b.course_id
+		LEFT JOIN user_courses uc ON c.id = uc.course_id AND uc.user_id = $1
+		WHERE b.user_id = $1 AND c.archived_at IS NULL
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []models.BookmarkedCourse
+	for rows.Next() {
+		var c models.BookmarkedCourse
+		err := rows.Scan(&c.ID, &c.Title, &c.Description, &c.Level, &c.Duration, &c.Instructor,
+			&c.VideoUrl, &c.Enrolled, &c.Completed, &c.TotalModules, &c.CompletedModules)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+type pgxActivities struct{ q querier }
+
+func (r pgxActivities) Touch(ctx context.Context, userID, courseID int, activityType string, window time.Duration) (bool, error) {
+	tag, err := r.q.Exec(ctx, `
+		UPDATE user_activities SET created_at = NOW()
+		WHERE id = (
+			SELECT id FROM user_activities
+			WHERE user_id = $1 AND course_id = $2 AND type = $3
+				AND created_at > NOW() - make_interval(secs => $4)
+			ORDER BY created_at DESC
+			LIMIT 1
+		)
+	`, userID, courseID, activityType, window.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r pgxActivities) Create(ctx context.Context, a models.Activity) error {
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO user_activities (user_id, course_id, title, type, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, a.UserID, a.CourseID, a.Title, a.Type, a.CreatedAt)
+	return err
+}
+
+func (r pgxActivities) Recent(ctx context.Context, userID, limit int) ([]models.Activity, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT id, course_id, title, type, created_at
+		FROM user_activities
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []models.Activity
+	for rows.Next() {
+		a := models.Activity{UserID: userID}
+		if err := rows.Scan(&a.ID, &a.CourseID, &a.Title, &a.Type, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		activities = append(activities, a)
+	}
+	return activities, rows.Err()
+}
+
+type pgxUsers struct{ q querier }
+
+func (r pgxUsers) Profile(ctx context.Context, userID int) (models.User, error) {
+	u := models.User{ID: userID}
+	err := r.q.QueryRow(ctx, `
+		SELECT email, username, role,
+			COALESCE(progress, 0), COALESCE(completed_courses, 0),
+			COALESCE(status, 'Pemula React Native'),
+			email_verified_at IS NOT NULL
+		FROM users WHERE id = $1
+	`, userID).Scan(&u.Email, &u.Username, &u.Role, &u.Progress, &u.CompletedCourses, &u.Status, &u.EmailVerified)
+	return u, notFound(err)
+}
+
+const adminUserColumns = `id, email, username, role, COALESCE(status, ''),
+	COALESCE(progress, 0), COALESCE(completed_courses, 0),
+	email_verified_at, suspended_at, COALESCE(suspended_reason, ''),
+	EXISTS(SELECT 1 FROM user_totp t WHERE t.user_id = users.id AND t.enabled_at IS NOT NULL)`
+
+func scanAdminUser(row pgx.Row) (models.AdminUser, error) {
+	var u models.AdminUser
+	err := row.Scan(&u.ID, &u.Email, &u.Username, &u.Role, &u.Status, &u.Progress, &u.CompletedCourses,
+		&u.EmailVerifiedAt, &u.SuspendedAt, &u.SuspendedReason, &u.TwoFactorEnabled)
+	return u, err
+}
+
+func (r pgxUsers) Admin(ctx context.Context, userID int) (models.AdminUser, error) {
+	u, err := scanAdminUser(r.q.QueryRow(ctx, "SELECT "+adminUserColumns+" FROM users WHERE id = $1", userID))
+	return u, notFound(err)
+}
+
+func (r pgxUsers) Search(ctx context.Context, f UserFilter, offset, limit int) ([]models.AdminUser, int, error) {
+	conditions := []string{"TRUE"}
+	var args []any
+	if f.Query != "" {
+		args = append(args, "%"+escapeLike(f.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf("(username ILIKE $%d OR email ILIKE $%d)", len(args), len(args)))
+	}
+	if f.Role != "" {
+		args = append(args, f.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+	switch f.Status {
+	case "":
+	case UserActive:
+		conditions = append(conditions, "suspended_at IS NULL AND email_verified_at IS NOT NULL")
+	case UserSuspended:
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	case UserUnverified:
+		conditions = append(conditions, "email_verified_at IS NULL")
+	default:
+		return nil, 0, fmt.Errorf("unknown user status %q", f.Status)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.q.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.q.Query(ctx, "SELECT "+adminUserColumns+" FROM users WHERE "+where+
+		fmt.Sprintf(" ORDER BY id LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+func (r pgxUsers) EmailVerified(ctx context.Context, userID int) (bool, error) {
+	var verified bool
+	err := r.q.QueryRow(ctx,
+		"SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&verified)
+	return verified, notFound(err)
+}
+
+func (r pgxUsers) UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error) {
+	var taken bool
+	err := r.q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND id <> $2)", username, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func (r pgxUsers) Lock(ctx context.Context, userID int) (models.AdminUser, error) {
+	u, err := scanAdminUser(r.q.QueryRow(ctx,
+		"SELECT "+adminUserColumns+" FROM users WHERE id = $1 FOR UPDATE", userID))
+	return u, notFound(err)
+}
+
+func (r pgxUsers) FindByEmail(ctx context.Context, email string) (models.AdminUser, error) {
+	u, err := scanAdminUser(r.q.QueryRow(ctx, "SELECT "+adminUserColumns+" FROM users WHERE LOWER(email) = LOWER($1) ORDER BY id LIMIT 1", email))
+	return u, notFound(err)
+}
+
+func (r pgxUsers) PasswordHash(ctx context.Context, userID int) (string, error) {
+	var hash string
+	err := r.q.QueryRow(ctx, "SELECT password FROM users WHERE id = $1", userID).Scan(&hash)
+	return hash, notFound(err)
+}
+
+func (r pgxUsers) EmailTaken(ctx context.Context, email string, exceptID int) (bool, error) {
+	var taken bool
+	err := r.q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)", email, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func (r pgxUsers) Create(ctx context.Context, u models.NewUser) (int, error) {
+	var id int
+	err := r.q.QueryRow(ctx, `
+		INSERT INTO users (username, email, password, role, progress, completed_courses, email_verified_at)
+		VALUES ($1, $2, $3, $4, 0, 0, CASE WHEN $5 THEN NOW() END)
+		RETURNING id
+	`, u.Username, u.Email, u.PasswordHash, u.Role, u.EmailVerified).Scan(&id)
+	return id, err
+}
+
+func (r pgxUsers) UpdateProfile(ctx context.Context, userID int, p models.ProfileUpdate) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE users SET
+			username = COALESCE($2, username),
+			email = COALESCE($3, email),
+			status = COALESCE($4, status),
+			email_verified_at = CASE WHEN $5 THEN NULL ELSE email_verified_at END
+		WHERE id = $1
+	`, userID, p.Username, p.Email, p.Status, p.ResetVerification)
+	return err
+}
+
+func (r pgxUsers) SetPassword(ctx context.Context, userID int, passwordHash string) error {
+	_, err := r.q.Exec(ctx, "UPDATE users SET password = $2 WHERE id = $1", userID, passwordHash)
+	return err
+}
+
+func (r pgxUsers) SetRole(ctx context.Context, userID int, role string) error {
+	_, err := r.q.Exec(ctx, "UPDATE users SET role = $2 WHERE id = $1", userID, role)
+	return err
+}
+
+func (r pgxUsers) Suspend(ctx context.Context, userID int, reason string) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()), suspended_reason = $2
+		WHERE id = $1
+	`, userID, reason)
+	return err
+}
+
+func (r pgxUsers) Reactivate(ctx context.Context, userID int) error {
+	_, err := r.q.Exec(ctx,
+		"UPDATE users SET suspended_at = NULL, suspended_reason = NULL WHERE id = $1", userID)
+	return err
+}
+
+func (r pgxUsers) VerifyEmail(ctx context.Context, userID int, email string) (bool, error) {
+	var alreadyVerified bool
+	err := r.q.QueryRow(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = $1 AND email = $2
+		RETURNING email_verified_at < NOW()
+	`, userID, email).Scan(&alreadyVerified)
+	return alreadyVerified, notFound(err)
+}
+
+func (r pgxUsers) Rename(ctx context.Context, userID int, username string) (string, error) {
+	var previous string
+	err := r.q.QueryRow(ctx,
+		"UPDATE users u SET username = $1 FROM users old WHERE u.id = $2 AND old.id = u.id RETURNING old.username",
+		username, userID).Scan(&previous)
+	return previous, notFound(err)
+}
+
+func (r pgxUsers) SetProgress(ctx context.Context, userID, progress, completedCourses int) error {
+	_, err := r.q.Exec(ctx,
+		"UPDATE users SET progress = $2, completed_courses = $3 WHERE id = $1",
+		userID, progress, completedCourses)
+	return err
+}
+
+func (r pgxUsers) SetGlobalProgress(ctx context.Context, userID, progress int) error {
+	_, err := r.q.Exec(ctx, "UPDATE users SET progress = $2 WHERE id = $1", userID, progress)
+	return err
+}
+
+func (r pgxUsers) SetCompletedCourses(ctx context.Context, userID, completedCourses int) error {
+	_, err := r.q.Exec(ctx,
+		"UPDATE users SET completed_courses = $2 WHERE id = $1", userID, completedCourses)
+	return err
+}
+
+// userOwnedTables lists the tables whose rows belong to a single user and
+// go away with the account.
+var userOwnedTables = []string{
+	"completed_modules",
+	"user_courses",
+	"user_bookmarks",
+	"user_activities",
+	"user_totp",
+	"user_recovery_codes",
+	"refresh_tokens",
+	"password_reset_tokens",
+}
+
+func (r pgxUsers) Delete(ctx context.Context, userID int) error {
+	for _, table := range userOwnedTables {
+		if _, err := r.q.Exec(ctx, "DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("deleting from %s: %w", table, err)
+		}
+	}
+	_, err := r.q.Exec(ctx, "DELETE FROM users WHERE id = $1", userID)
+	return err
+}
+
+type pgxSessions struct{ q querier }
+
+func (r pgxSessions) Create(ctx context.Context, t models.RefreshToken) error {
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, user_agent, ip, mfa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.UserID, t.FamilyID, t.Hash, t.ExpiresAt, t.UserAgent, t.IP, t.MFA)
+	return err
+}
+
+func (r pgxSessions) Lock(ctx context.Context, hash string) (models.RefreshToken, error) {
+	t := models.RefreshToken{Hash: hash}
+	err := r.q.QueryRow(ctx, `
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at, mfa
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt, &t.MFA)
+	return t, notFound(err)
+}
+
+func (r pgxSessions) MarkUsed(ctx context.Context, tokenID int64) error {
+	_, err := r.q.Exec(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID)
+	return err
+}
+
+func (r pgxSessions) RevokeFamily(ctx context.Context, familyID, reason string) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW(), revoke_reason = $2
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID, reason)
+	return err
+}
+
+func (r pgxSessions) RevokeFamilyOf(ctx context.Context, hash, reason string) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW(), revoke_reason = $2
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM refresh_tokens WHERE token_hash = $1
+		)
+	`, hash, reason)
+	return err
+}
+
+func (r pgxSessions) RevokeUser(ctx context.Context, userID int, reason string) (int64, error) {
+	tag, err := r.q.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW(), revoke_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID, reason)
+	return tag.RowsAffected(), err
+}
+
+type pgxThrottles struct{ q querier }
+
+func (r pgxThrottles) LockedUntil(ctx context.Context, keys []ThrottleKey) (time.Time, error) {
+	var scopes, values []string
+	for _, k := range keys {
+		scopes = append(scopes, k.Scope)
+		values = append(values, k.Key)
+	}
+
+	var lockedUntil *time.Time
+	err := r.q.QueryRow(ctx, `
+		SELECT MAX(locked_until) FROM login_throttles
+		WHERE (scope, key) IN (SELECT * FROM unnest($1::text[], $2::text[]))
+	`, scopes, values).Scan(&lockedUntil)
+	if err != nil || lockedUntil == nil {
+		return time.Time{}, err
+	}
+	return *lockedUntil, nil
+}
+
+func (r pgxThrottles) Hit(ctx context.Context, key ThrottleKey, window time.Duration) (int, error) {
+	var failures int
+	err := r.q.QueryRow(ctx, `
+		INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`, key.Scope, key.Key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func (r pgxThrottles) Lock(ctx context.Context, key ThrottleKey, d time.Duration) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE login_throttles SET locked_until = NOW() + make_interval(secs => $3)
+		WHERE scope = $1 AND key = $2
+	`, key.Scope, key.Key, d.Seconds())
+	return err
+}
+
+// Account counters are keyed by the lower-cased email, which links them to
+// the account when one is registered.
+const loginThrottleColumns = `t.scope, t.key, u.id, t.failures, t.last_failure_at, t.locked_until,
+	COALESCE(t.locked_until > NOW(), false)`
+
+const loginThrottleFrom = `login_throttles t
+	LEFT JOIN users u ON t.scope = 'account' AND LOWER(u.email) = t.key`
+
+func scanLoginThrottle(row pgx.Row) (models.LoginThrottle, error) {
+	var t models.LoginThrottle
+	err := row.Scan(&t.Scope, &t.Key, &t.UserID, &t.Failures, &t.LastFailureAt, &t.LockedUntil, &t.Locked)
+	return t, err
+}
+
+func (r pgxThrottles) Get(ctx context.Context, key ThrottleKey) (models.LoginThrottle, error) {
+	t, err := scanLoginThrottle(r.q.QueryRow(ctx, `
+		SELECT `+loginThrottleColumns+`
+		FROM `+loginThrottleFrom+`
+		WHERE t.scope = $1 AND t.key = $2
+	`, key.Scope, key.Key))
+	return t, notFound(err)
+}
+
+func (r pgxThrottles) Locked(ctx context.Context) ([]models.LoginThrottle, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT `+loginThrottleColumns+`
+		FROM `+loginThrottleFrom+`
+		WHERE t.locked_until > NOW()
+		ORDER BY t.locked_until DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := []models.LoginThrottle{}
+	for rows.Next() {
+		t, err := scanLoginThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
+
+func (r pgxThrottles) Clear(ctx context.Context, key ThrottleKey) (models.LoginThrottle, error) {
+	t := models.LoginThrottle{Scope: key.Scope, Key: key.Key}
+	err := r.q.QueryRow(ctx,
+		"DELETE FROM login_throttles WHERE scope = $1 AND key = $2 RETURNING failures, last_failure_at, locked_until",
+		key.Scope, key.Key).Scan(&t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	return t, notFound(err)
+}
+
+type pgxTwoFactor struct{ q querier }
+
+func (r pgxTwoFactor) Enabled(ctx context.Context, userID int) (bool, error) {
+	var enabled bool
+	err := r.q.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)",
+		userID).Scan(&enabled)
+	return enabled, err
+}
+
+func (r pgxTwoFactor) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	var left int
+	err := r.q.QueryRow(ctx,
+		"SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID).Scan(&left)
+	return left, err
+}
+
+func (r pgxTwoFactor) SetPending(ctx context.Context, userID int, secret string) error {
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secret)
+	return err
+}
+
+func (r pgxTwoFactor) Lock(ctx context.Context, userID int) (models.TOTPSecret, error) {
+	s := models.TOTPSecret{UserID: userID}
+	err := r.q.QueryRow(ctx,
+		"SELECT secret, last_used_step, enabled_at FROM user_totp WHERE user_id = $1 FOR UPDATE",
+		userID).Scan(&s.Secret, &s.LastUsedStep, &s.EnabledAt)
+	return s, notFound(err)
+}
+
+func (r pgxTwoFactor) Enable(ctx context.Context, userID int, step int64) error {
+	_, err := r.q.Exec(ctx,
+		"UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2 WHERE user_id = $1", userID, step)
+	return err
+}
+
+func (r pgxTwoFactor) SetLastStep(ctx context.Context, userID int, step int64) error {
+	_, err := r.q.Exec(ctx, "UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1", userID, step)
+	return err
+}
+
+func (r pgxTwoFactor) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	tag, err := r.q.Exec(ctx, `
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hash)
+	return tag.RowsAffected() == 1, err
+}
+
+func (r pgxTwoFactor) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	if _, err := r.q.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		_, err := r.q.Exec(ctx,
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r pgxTwoFactor) Disable(ctx context.Context, userID int) error {
+	if _, err := r.q.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := r.q.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+type pgxPasswordResets struct{ q querier }
+
+func (r pgxPasswordResets) Replace(ctx context.Context, t models.PasswordReset) error {
+	if err := r.DiscardUnused(ctx, t.UserID); err != nil {
+		return err
+	}
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, ip)
+		VALUES ($1, $2, $3, $4)
+	`, t.UserID, t.Hash, t.ExpiresAt, t.IP)
+	return err
+}
+
+func (r pgxPasswordResets) Lock(ctx context.Context, hash string) (models.PasswordReset, error) {
+	t := models.PasswordReset{Hash: hash}
+	err := r.q.QueryRow(ctx, `
+		SELECT id, user_id, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hash).Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.UsedAt)
+	return t, notFound(err)
+}
+
+func (r pgxPasswordResets) Redeem(ctx context.Context, t models.PasswordReset) error {
+	if _, err := r.q.Exec(ctx, "UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1", t.ID); err != nil {
+		return err
+	}
+	return r.DiscardUnused(ctx, t.UserID)
+}
+
+func (r pgxPasswordResets) DiscardUnused(ctx context.Context, userID int) error {
+	_, err := r.q.Exec(ctx,
+		"DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL", userID)
+	return err
+}
+
+type pgxTemplates struct{ q querier }
+
+// templateColumns is the column list scanTemplate expects.
+const templateColumns = "id, name, COALESCE(level, ''), description, modules"
+
+func scanTemplate(row pgx.Row) (models.CourseTemplate, error) {
+	var t models.CourseTemplate
+	var modules []byte
+	if err := row.Scan(&t.ID, &t.Name, &t.Level, &t.Description, &modules); err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(modules, &t.Modules); err != nil {
+		return t, fmt.Errorf("decoding modules of template %d: %w", t.ID, err)
+	}
+	return t, nil
+}
+
+func (r pgxTemplates) Get(ctx context.Context, templateID int) (models.CourseTemplate, error) {
+	t, err := scanTemplate(r.q.QueryRow(ctx,
+		"SELECT "+templateColumns+" FROM course_templates WHERE id = $1", templateID))
+	return t, notFound(err)
+}
+
+func (r pgxTemplates) ForLevel(ctx context.Context, level string) (models.CourseTemplate, error) {
+	t, err := scanTemplate(r.q.QueryRow(ctx,
+		"SELECT "+templateColumns+" FROM course_templates WHERE level = $1 ORDER BY id LIMIT 1",
+		strings.ToLower(level)))
+	return t, notFound(err)
+}
+
+func (r pgxTemplates) List(ctx context.Context) ([]models.CourseTemplate, error) {
+	rows, err := r.q.Query(ctx, "SELECT "+templateColumns+" FROM course_templates ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.CourseTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func (r pgxTemplates) Create(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error) {
+	modules, err := json.Marshal(t.Modules)
+	if err != nil {
+		return t, err
+	}
+	return scanTemplate(r.q.QueryRow(ctx, `
+		INSERT INTO course_templates (name, level, description, modules)
+		VALUES ($1, NULLIF($2, ''), $3, $4::jsonb)
+		RETURNING `+templateColumns,
+		t.Name, t.Level, t.Description, string(modules)))
+}
+
+func (r pgxTemplates) Update(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error) {
+	modules, err := json.Marshal(t.Modules)
+	if err != nil {
+		return t, err
+	}
+	t, err = scanTemplate(r.q.QueryRow(ctx, `
+		UPDATE course_templates
+		SET name = $1, level = NULLIF($2, ''), description = $3, modules = $4::jsonb,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING `+templateColumns,
+		t.Name, t.Level, t.Description, string(modules), t.ID))
+	return t, notFound(err)
+}
+
+func (r pgxTemplates) Delete(ctx context.Context, templateID int) (models.CourseTemplate, error) {
+	t, err := scanTemplate(r.q.QueryRow(ctx,
+		"DELETE FROM course_templates WHERE id = $1 RETURNING "+templateColumns, templateID))
+	return t, notFound(err)
+}
+
+type pgxAudit struct{ q querier }
+
+// rawJSON passes a JSON document to a jsonb parameter, or NULL.
+func rawJSON(b json.RawMessage) *string {
+	if b == nil {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
+
+func (r pgxAudit) Record(ctx context.Context, e models.AuditEntry) error {
+	_, err := r.q.Exec(ctx, `
+		INSERT INTO audit_log (actor_id, actor_role, action, target_type, target_id, before, after, ip, request_id)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6::jsonb, $7::jsonb, NULLIF($8, ''), NULLIF($9, ''))
+	`, e.ActorID, e.ActorRole, e.Action, e.TargetType, e.TargetID, rawJSON(e.Before), rawJSON(e.After), e.IP, e.RequestID)
+	return err
+}
+
+// auditWhere turns f into a WHERE clause and its arguments.
+func auditWhere(f AuditFilter) (string, []any) {
+	conditions := []string{"TRUE"}
+	var args []any
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.ActorID != nil {
+		add("actor_id = $%d", *f.ActorID)
+	}
+	if f.Action != "" {
+		if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+			add(`action LIKE $%d`, escapeLike(prefix)+"%")
+		} else {
+			add("action = $%d", f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if f.RequestID != "" {
+		add("request_id = $%d", f.RequestID)
+	}
+	if !f.From.IsZero() {
+		add("occurred_at >= $%d", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("occurred_at < $%d", f.To.UTC())
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+const auditColumns = `id, occurred_at, actor_id, COALESCE(actor_role, ''), action, target_type,
+	COALESCE(target_id, ''), before, after, COALESCE(ip, ''), COALESCE(request_id, '')`
+
+func scanAuditEntry(row pgx.Row) (models.AuditEntry, error) {
+	var e models.AuditEntry
+	var occurredAt time.Time
+	var before, after []byte
+	err := row.Scan(&e.ID, &occurredAt, &e.ActorID, &e.ActorRole, &e.Action, &e.TargetType,
+		&e.TargetID, &before, &after, &e.IP, &e.RequestID)
+	if err != nil {
+		return e, err
+	}
+	e.OccurredAt = formatTime(&occurredAt)
+	if before != nil {
+		e.Before = json.RawMessage(before)
+	}
+	if after != nil {
+		e.After = json.RawMessage(after)
+	}
+	return e, nil
+}
+
+func (r pgxAudit) Count(ctx context.Context, f AuditFilter) (int, error) {
+	where, args := auditWhere(f)
+	var total int
+	err := r.q.QueryRow(ctx, "SELECT COUNT(*) FROM audit_log WHERE "+where, args...).Scan(&total)
+	return total, err
+}
+
+func (r pgxAudit) List(ctx context.Context, f AuditFilter, offset, limit int) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	where, args := auditWhere(f)
+	args = append(args, limit, offset)
+	err := r.each(ctx, "SELECT "+auditColumns+" FROM audit_log WHERE "+where+
+		fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args,
+		func(e models.AuditEntry) error {
+			entries = append(entries, e)
+			return nil
+		})
+	return entries, err
+}
+
+func (r pgxAudit) After(ctx context.Context, f AuditFilter, afterID int64, limit int) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	where, args := auditWhere(f)
+	args = append(args, afterID, limit)
+	err := r.each(ctx, "SELECT "+auditColumns+" FROM audit_log WHERE "+where+
+		fmt.Sprintf(" AND id > $%d ORDER BY id LIMIT $%d", len(args)-1, len(args)), args,
+		func(e models.AuditEntry) error {
+			entries = append(entries, e)
+			return nil
+		})
+	return entries, err
+}
+
+func (r pgxAudit) each(ctx context.Context, sql string, args []any, fn func(models.AuditEntry) error) error {
+	rows, err := r.q.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type pgxMaintenance struct{ q querier }
+
+func (r pgxMaintenance) Start(ctx context.Context, job string, actorID int, dryRun bool) (int64, error) {
+	var runID int64
+	err := r.q.QueryRow(ctx, `
+		INSERT INTO maintenance_runs (job, actor_id, dry_run, status)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING id
+	`, job, actorID, dryRun, models.RunRunning).Scan(&runID)
+	return runID, err
+}
+
+func (r pgxMaintenance) Finish(ctx context.Context, runID int64, status string, summary []byte, errText string) error {
+	_, err := r.q.Exec(ctx, `
+		UPDATE maintenance_runs
+		SET status = $2, finished_at = NOW(), summary = $3::jsonb, error = NULLIF($4, '')
+		WHERE id = $1
+	`, runID, status, string(summary), errText)
+	return err
+}
+
+const maintenanceRunColumns = `id, job, actor_id, dry_run, status, started_at, finished_at, summary, COALESCE(error, '')`
+
+func scanMaintenanceRun(row pgx.Row) (models.MaintenanceRun, error) {
+	var run models.MaintenanceRun
+	var startedAt time.Time
+	var finishedAt *time.Time
+	var summary []byte
+	err := row.Scan(&run.ID, &run.Job, &run.ActorID, &run.DryRun, &run.Status,
+		&startedAt, &finishedAt, &summary, &run.Error)
+	run.StartedAt = formatTime(&startedAt)
+	run.FinishedAt = formatTime(finishedAt)
+	if summary != nil {
+		run.Summary = json.RawMessage(summary)
+	}
+	return run, err
+}
+
+func (r pgxMaintenance) List(ctx context.Context, job, status string, limit int) ([]models.MaintenanceRun, error) {
+	rows, err := r.q.Query(ctx, `
+		SELECT `+maintenanceRunColumns+`
+		FROM maintenance_runs
+		WHERE ($1 = '' OR job = $1) AND ($2 = '' OR status = $2)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $3
+	`, job, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.MaintenanceRun{}
+	for rows.Next() {
+		run, err := scanMaintenanceRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		run.Summary = nil
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (r pgxMaintenance) Get(ctx context.Context, runID int64) (models.MaintenanceRun, error) {
+	run, err := scanMaintenanceRun(r.q.QueryRow(ctx,
+		"SELECT "+maintenanceRunColumns+" FROM maintenance_runs WHERE id = $1", runID))
+	return run, notFound(err)
+}
+
+func (r pgxMaintenance) LockJob(ctx context.Context, job string) error {
+	var locked bool
+	err := r.q.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", job).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return ErrJobRunning
+	}
+	_, err = r.q.Exec(ctx, "SET LOCAL statement_timeout = 0")
+	return err
+}
@@ -0,0 +1,394 @@
+// Package repository hides the database behind one interface per domain so
+// handlers can run against Postgres in production and against MemoryStore
+// in unit tests.
+//
+// Repositories report a missing row as ErrNotFound rather than a driver
+// error, and archived courses are treated as gone unless a method says
+// otherwise.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/models"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrBadTransition is returned for enrollment changes the state machine
+	// does not allow.
+	ErrBadTransition = errors.New("enrollment cannot make this transition")
+	// ErrJobRunning is returned by LockJob while another run of the job
+	// holds the lock.
+	ErrJobRunning = errors.New("another run of this job is in progress")
+)
+
+type CourseRepository interface {
+	// Exists reports whether the course exists and is not archived.
+	Exists(ctx context.Context, courseID int) (bool, error)
+	// Title returns the title of a course, archived or not.
+	Title(ctx context.Context, courseID int) (string, error)
+	// Find returns a course, archived or not.
+	Find(ctx context.Context, courseID int) (models.Course, error)
+	// Lock is Find that also locks the course for the rest of the
+	// transaction.
+	Lock(ctx context.Context, courseID int) (models.Course, error)
+	// List returns the courses that are not archived, by ID, as the user
+	// sees them.
+	List(ctx context.Context, userID int) ([]models.LearnerCourse, error)
+	// Search returns up to limit courses that are not archived and whose
+	// title or description contains query, titles that start with it first.
+	Search(ctx context.Context, userID int, query string, limit int) ([]models.LearnerCourse, error)
+	// Get returns a course that is not archived as the user sees it.
+	Get(ctx context.Context, userID, courseID int) (models.LearnerCourse, error)
+	// Count counts the courses that are not archived.
+	Count(ctx context.Context) (int, error)
+	// Page returns up to limit courses that are not archived, by ID,
+	// skipping the first offset.
+	Page(ctx context.Context, offset, limit int) ([]models.Course, error)
+	// Create inserts a course and returns its ID.
+	Create(ctx context.Context, c models.Course) (int, error)
+	// Update writes the course's title, description, level, duration,
+	// instructor and video URL.
+	Update(ctx context.Context, c models.Course) error
+	// Archive marks a course as archived by the user and returns when. The
+	// caller checks that it is not archived already.
+	Archive(ctx context.Context, courseID, by int) (time.Time, error)
+	// Restore clears the archive mark of a course.
+	Restore(ctx context.Context, courseID int) error
+	// Archived returns the archived courses, most recently archived first.
+	// An ownerID of 0 returns those of every owner.
+	Archived(ctx context.Context, ownerID int) ([]models.Course, error)
+	// ArchivedBefore returns the IDs of the courses archived before cutoff,
+	// by ID, and locks them for the rest of the transaction.
+	ArchivedBefore(ctx context.Context, cutoff time.Time) ([]int, error)
+	// Purge deletes a course together with its modules, completions,
+	// enrollments, bookmarks and activities.
+	Purge(ctx context.Context, courseID int) error
+}
+
+type ModuleRepository interface {
+	// CourseID returns the course a module belongs to.
+	CourseID(ctx context.Context, moduleID int) (int, error)
+	// ForCourse returns the course's modules in order, ties broken by ID.
+	ForCourse(ctx context.Context, courseID int) ([]models.CourseModule, error)
+	// Lock is ForCourse that also locks the modules for the rest of the
+	// transaction.
+	Lock(ctx context.Context, courseID int) ([]models.CourseModule, error)
+	Count(ctx context.Context, courseID int) (int, error)
+	// Get returns a module of the course; a module of another course is
+	// ErrNotFound.
+	Get(ctx context.Context, courseID, moduleID int) (models.CourseModule, error)
+	// Create inserts a module and returns its ID.
+	Create(ctx context.Context, m models.CourseModule) (int, error)
+	// Update writes the module's title, description, content, video URL and
+	// order.
+	Update(ctx context.Context, m models.CourseModule) error
+	// SetAutoGenerated flags or unflags a module as placeholder content.
+	SetAutoGenerated(ctx context.Context, moduleID int, autoGenerated bool) error
+	// AutoGenerated returns every module flagged as placeholder content by
+	// course and order.
+	AutoGenerated(ctx context.Context) ([]models.AutoGeneratedModule, error)
+	// Dangling returns the completions whose module is missing, belongs to
+	// another course or is placeholder content, by course, module and user.
+	Dangling(ctx context.Context) ([]models.DanglingCompletion, error)
+	// Delete removes modules of a course together with their completions
+	// and returns how many completions went with them.
+	Delete(ctx context.Context, courseID int, moduleIDs []int) (completionsRemoved int64, err error)
+	// Renumber rewrites the order of a course's modules as a gap-free 1..n
+	// sequence, keeping their relative order (ties broken by ID).
+	Renumber(ctx context.Context, courseID int) error
+	// Duplicates returns every module that shares its title with an earlier
+	// module of the same course. The survivor is the first module by order,
+	// ties broken by ID.
+	Duplicates(ctx context.Context) ([]models.DuplicateModule, error)
+	// Merge moves the completions of each duplicate onto its survivor,
+	// keeping the earliest when a learner completed both, and deletes the
+	// duplicates. Renumbering the courses is left to the caller.
+	Merge(ctx context.Context, duplicates []models.DuplicateModule) error
+	// Complete records that the user finished the module. Completing it
+	// twice is not an error.
+	Complete(ctx context.Context, userID, courseID, moduleID int) error
+	Uncomplete(ctx context.Context, userID, moduleID int) error
+	// Completed returns the IDs of the course's modules the user finished.
+	Completed(ctx context.Context, userID, courseID int) (map[int]bool, error)
+	// Progress counts the course's modules and those the user completed.
+	Progress(ctx context.Context, userID, courseID int) (completed, total int, err error)
+}
+
+type EnrollmentRepository interface {
+	// Get returns the user's enrollment in a course. Progress is left for
+	// the caller to derive from the module counts.
+	Get(ctx context.Context, userID, courseID int) (models.UserCourse, error)
+	// Status returns the state of the user's enrollment in a course.
+	Status(ctx context.Context, userID, courseID int) (string, error)
+	// Transition moves the user's enrollment in a course to target and
+	// returns the state it was in, or "" when it had to be created. Only an
+	// active target creates an enrollment; pausing or dropping a missing one
+	// is ErrNotFound. A completed enrollment stays completed when made
+	// active, and only an active one can be paused (ErrBadTransition).
+	// Run it inside WithTx so the check and the change are atomic.
+	Transition(ctx context.Context, userID, courseID int, target string) (from string, err error)
+	// MarkCompleted completes the enrollment unless it already is.
+	MarkCompleted(ctx context.Context, userID, courseID int) error
+	// Reopen moves a completed enrollment back to active, for when one of
+	// the course's modules is no longer completed. Other states are left
+	// alone.
+	Reopen(ctx context.Context, userID, courseID int) error
+	CountCompleted(ctx context.Context, userID int) (int, error)
+	// ModuleTotals counts modules over the courses the user is enrolled in
+	// and has not dropped, leaving out archived courses.
+	ModuleTotals(ctx context.Context, userID int) (completed, total int, err error)
+}
+
+// transitionChanges reports whether moving an enrollment from one state to
+// target changes it, or returns ErrBadTransition when the move is not
+// allowed.
+func transitionChanges(from, target string) (bool, error) {
+	switch {
+	case from == target:
+		return false, nil
+	case from == models.EnrollmentCompleted && target == models.EnrollmentActive:
+		// Re-enrolling in a finished course keeps it completed.
+		return false, nil
+	case target == models.EnrollmentPaused && from != models.EnrollmentActive:
+		return false, ErrBadTransition
+	}
+	return true, nil
+}
+
+type BookmarkRepository interface {
+	Exists(ctx context.Context, userID, courseID int) (bool, error)
+	Add(ctx context.Context, userID, courseID int) error
+	Remove(ctx context.Context, userID, courseID int) error
+	// Courses lists the user's bookmarked courses, newest bookmark first.
+	// Progress is left for the caller to derive from the module counts.
+	Courses(ctx context.Context, userID int) ([]models.BookmarkedCourse, error)
+}
+
+type ActivityRepository interface {
+	// Touch moves the newest activity of the same kind newer than window to
+	// now and reports whether there was one.
+	Touch(ctx context.Context, userID, courseID int, activityType string, window time.Duration) (bool, error)
+	Create(ctx context.Context, a models.Activity) error
+	// Recent returns the user's latest activities, newest first.
+	Recent(ctx context.Context, userID, limit int) ([]models.Activity, error)
+}
+
+// Account states accepted by UserFilter.Status.
+const (
+	UserActive     = "active"
+	UserSuspended  = "suspended"
+	UserUnverified = "unverified"
+)
+
+// UserFilter narrows Users().Search. Query matches part of the username or
+// email; empty fields match every account.
+type UserFilter struct {
+	Query  string
+	Role   string
+	Status string
+}
+
+type UserRepository interface {
+	// Profile returns the user's own view of their account.
+	Profile(ctx context.Context, userID int) (models.User, error)
+	// Admin returns the administrators' view of an account.
+	Admin(ctx context.Context, userID int) (models.AdminUser, error)
+	// Lock is Admin that also locks the account for the rest of the
+	// transaction.
+	Lock(ctx context.Context, userID int) (models.AdminUser, error)
+	// FindByEmail returns the administrators' view of the account with the
+	// email, compared case-insensitively; the oldest account wins if rows
+	// from before emails were normalized differ only in case.
+	FindByEmail(ctx context.Context, email string) (models.AdminUser, error)
+	PasswordHash(ctx context.Context, userID int) (string, error)
+	// Search returns one page of the accounts matching f, by ID, and how
+	// many match in all.
+	Search(ctx context.Context, f UserFilter, offset, limit int) ([]models.AdminUser, int, error)
+	EmailVerified(ctx context.Context, userID int) (bool, error)
+	// UsernameTaken reports whether another account than exceptID uses the
+	// username.
+	UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error)
+	// EmailTaken reports whether another account than exceptID uses the
+	// email, ignoring case.
+	EmailTaken(ctx context.Context, email string, exceptID int) (bool, error)
+	// Create inserts an account without progress and returns its ID.
+	Create(ctx context.Context, u models.NewUser) (int, error)
+	UpdateProfile(ctx context.Context, userID int, p models.ProfileUpdate) error
+	SetPassword(ctx context.Context, userID int, passwordHash string) error
+	SetRole(ctx context.Context, userID int, role string) error
+	// Suspend marks the account suspended, keeping the time of an earlier
+	// suspension, and records the reason.
+	Suspend(ctx context.Context, userID int, reason string) error
+	Reactivate(ctx context.Context, userID int) error
+	// VerifyEmail marks the email verified if it is still the account's and
+	// reports whether it already was. A changed email is ErrNotFound.
+	VerifyEmail(ctx context.Context, userID int, email string) (alreadyVerified bool, err error)
+	// Rename changes a username and returns the previous one.
+	Rename(ctx context.Context, userID int, username string) (string, error)
+	SetProgress(ctx context.Context, userID, progress, completedCourses int) error
+	SetGlobalProgress(ctx context.Context, userID, progress int) error
+	SetCompletedCourses(ctx context.Context, userID, completedCourses int) error
+	// Delete removes a user and every row they own.
+	Delete(ctx context.Context, userID int) error
+}
+
+type TemplateRepository interface {
+	Get(ctx context.Context, templateID int) (models.CourseTemplate, error)
+	// ForLevel returns the oldest template registered for a course level.
+	ForLevel(ctx context.Context, level string) (models.CourseTemplate, error)
+	// List returns every template by name.
+	List(ctx context.Context) ([]models.CourseTemplate, error)
+	// Create inserts a template and returns it as stored.
+	Create(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error)
+	// Update replaces the template with t.ID and returns it as stored.
+	Update(ctx context.Context, t models.CourseTemplate) (models.CourseTemplate, error)
+	// Delete removes a template and returns what it held.
+	Delete(ctx context.Context, templateID int) (models.CourseTemplate, error)
+}
+
+// SessionRepository stores refresh tokens. Each login starts a family that
+// the tokens issued by refreshing it join.
+type SessionRepository interface {
+	// Create stores a refresh token; its ID is assigned.
+	Create(ctx context.Context, t models.RefreshToken) error
+	// Lock returns the token with the hash and locks it for the rest of the
+	// transaction.
+	Lock(ctx context.Context, hash string) (models.RefreshToken, error)
+	MarkUsed(ctx context.Context, tokenID int64) error
+	// RevokeFamily revokes the tokens of a family that are not revoked yet.
+	RevokeFamily(ctx context.Context, familyID, reason string) error
+	// RevokeFamilyOf is RevokeFamily for the family of the token with the
+	// hash. Unknown hashes revoke nothing.
+	RevokeFamilyOf(ctx context.Context, hash, reason string) error
+	// RevokeUser revokes every token of the user and returns how many.
+	RevokeUser(ctx context.Context, userID int, reason string) (int64, error)
+}
+
+// ThrottleKey names one failure counter.
+type ThrottleKey struct {
+	Scope string
+	Key   string
+}
+
+// ThrottleRepository keeps the failure counters that rate-limit logins and
+// mail requests.
+type ThrottleRepository interface {
+	// LockedUntil returns the latest lock among the keys, or the zero time
+	// when none of them was ever locked.
+	LockedUntil(ctx context.Context, keys []ThrottleKey) (time.Time, error)
+	// Hit counts a failure against the key and returns the count. A counter
+	// quiet for longer than window starts over.
+	Hit(ctx context.Context, key ThrottleKey, window time.Duration) (int, error)
+	// Lock blocks the key for d from now.
+	Lock(ctx context.Context, key ThrottleKey, d time.Duration) error
+	Get(ctx context.Context, key ThrottleKey) (models.LoginThrottle, error)
+	// Locked returns the counters locked now, latest lock first.
+	Locked(ctx context.Context) ([]models.LoginThrottle, error)
+	// Clear deletes a counter and returns what it held.
+	Clear(ctx context.Context, key ThrottleKey) (models.LoginThrottle, error)
+}
+
+// TwoFactorRepository stores TOTP secrets and recovery codes; codes are
+// kept as hashes only.
+type TwoFactorRepository interface {
+	// Enabled reports whether the user confirmed a TOTP secret.
+	Enabled(ctx context.Context, userID int) (bool, error)
+	// RecoveryCodesLeft counts the user's unused recovery codes.
+	RecoveryCodesLeft(ctx context.Context, userID int) (int, error)
+	// SetPending stores a secret awaiting confirmation, replacing a pending
+	// one. An enabled secret is left alone.
+	SetPending(ctx context.Context, userID int, secret string) error
+	// Lock returns the user's secret and locks it for the rest of the
+	// transaction.
+	Lock(ctx context.Context, userID int) (models.TOTPSecret, error)
+	// Enable confirms the pending secret with the step of the first code.
+	Enable(ctx context.Context, userID int, step int64) error
+	// SetLastStep records the step of a used code so it cannot be replayed.
+	SetLastStep(ctx context.Context, userID int, step int64) error
+	// UseRecoveryCode marks an unused recovery code used and reports whether
+	// there was one.
+	UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+	// ReplaceRecoveryCodes discards the user's recovery codes and stores
+	// hashes instead.
+	ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error
+	// Disable removes the user's secret and recovery codes.
+	Disable(ctx context.Context, userID int) error
+}
+
+// PasswordResetRepository stores password reset tokens as hashes.
+type PasswordResetRepository interface {
+	// Replace discards the user's unused tokens and stores t.
+	Replace(ctx context.Context, t models.PasswordReset) error
+	// Lock returns the token with the hash and locks it for the rest of the
+	// transaction.
+	Lock(ctx context.Context, hash string) (models.PasswordReset, error)
+	// Redeem marks a token used and discards the user's other unused ones.
+	Redeem(ctx context.Context, t models.PasswordReset) error
+	// DiscardUnused removes the user's unused tokens.
+	DiscardUnused(ctx context.Context, userID int) error
+}
+
+// AuditFilter narrows the audit log. Action may end in "*" to match a
+// prefix, e.g. "user.*"; zero fields match every entry.
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From, To   time.Time
+}
+
+// AuditRepository is the append-only audit log.
+type AuditRepository interface {
+	// Record appends an entry; its ID and OccurredAt are assigned.
+	Record(ctx context.Context, e models.AuditEntry) error
+	Count(ctx context.Context, f AuditFilter) (int, error)
+	// List returns one page of the entries matching f, newest first.
+	List(ctx context.Context, f AuditFilter, offset, limit int) ([]models.AuditEntry, error)
+	// After returns up to limit entries matching f whose ID is above
+	// afterID, oldest first. Long exports page through it so that no single
+	// query runs into the statement timeout.
+	After(ctx context.Context, f AuditFilter, afterID int64, limit int) ([]models.AuditEntry, error)
+}
+
+// MaintenanceRepository records runs of maintenance jobs.
+type MaintenanceRepository interface {
+	// Start records a running job and returns the run's ID. actorID 0
+	// means the system started it.
+	Start(ctx context.Context, job string, actorID int, dryRun bool) (int64, error)
+	// Finish records how a run ended; errText is empty on success.
+	Finish(ctx context.Context, runID int64, status string, summary []byte, errText string) error
+	// List returns up to limit runs, newest first, without their summaries.
+	// Empty job and status match every run.
+	List(ctx context.Context, job, status string, limit int) ([]models.MaintenanceRun, error)
+	Get(ctx context.Context, runID int64) (models.MaintenanceRun, error)
+	// LockJob takes the job's lock for the rest of the transaction, or
+	// returns ErrJobRunning when another run holds it. Jobs may touch every
+	// row of a table, so the per-query timeout is lifted as well.
+	LockJob(ctx context.Context, job string) error
+}
+
+// Store hands out the repositories. Those of the Store passed to WithTx's
+// callback share one transaction, which commits when the callback returns
+// nil and rolls back otherwise.
+type Store interface {
+	Courses() CourseRepository
+	Modules() ModuleRepository
+	Enrollments() EnrollmentRepository
+	Bookmarks() BookmarkRepository
+	Activities() ActivityRepository
+	Users() UserRepository
+	Sessions() SessionRepository
+	Throttles() ThrottleRepository
+	TwoFactor() TwoFactorRepository
+	PasswordResets() PasswordResetRepository
+	Templates() TemplateRepository
+	Audit() AuditRepository
+	Maintenance() MaintenanceRepository
+	WithTx(ctx context.Context, fn func(Store) error) error
+}
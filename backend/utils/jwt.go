@@ -1,49 +1,164 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"os"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
-var jwtKey = []byte(getJWTSecret())
 
-func getJWTSecret() string {
-    secret := os.Getenv("JWT_SECRET")
-    if secret == "" {
-        return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+// Token lifetimes. main replaces these defaults with the configured values
+// before serving.
+var (
+    // AccessTokenTTL is kept short because access tokens cannot be revoked;
+    // clients renew them with a refresh token.
+    AccessTokenTTL  = 15 * time.Minute
+    RefreshTokenTTL = 30 * 24 * time.Hour
+    // PasswordResetTTL bounds how long an emailed reset link stays usable.
+    PasswordResetTTL = time.Hour
+    EmailVerificationTTL = 48 * time.Hour
+)
+
+// Special-purpose tokens carry a "purpose" claim and are only accepted by
+// their own verifier. Access tokens carry no purpose claim.
+const (
+    purposeEmailVerification  = "email_verification"
+    purposeTwoFactorChallenge = "two_factor_challenge"
+)
+
+// TwoFactorChallengeTTL is how long a user has to enter their second factor
+// after the password step of a login.
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// VerifyToken validates an access token issued by any configured key.
+// Special-purpose tokens such as verification links are rejected.
+func VerifyToken(tokenString string) (jwt.MapClaims, error) {
+    claims, err := Tokens().Verify(tokenString)
+    if err != nil {
+        return nil, err
     }
-    return secret
+    if _, ok := claims["purpose"]; ok {
+        return nil, errors.New("not an access token")
+    }
+    return claims, nil
 }
 
-func VerifyToken(tokenString string) (jwt.MapClaims, error) {
-    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, errors.New("unexpected signing method")
-        }
-        return jwtKey, nil
-    })
+func signPurposeToken(purpose string, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+    now := time.Now()
+    claims["purpose"] = purpose
+    claims["iat"] = now.Unix()
+    claims["exp"] = now.Add(ttl).Unix()
+    return Tokens().Sign(claims)
+}
 
+func verifyPurposeToken(tokenString, purpose string) (jwt.MapClaims, int, error) {
+    claims, err := Tokens().Verify(tokenString)
     if err != nil {
-        return nil, err
+        return nil, 0, err
+    }
+    if p, _ := claims["purpose"].(string); p != purpose {
+        return nil, 0, fmt.Errorf("not a %s token", purpose)
     }
+    userID, ok := claims["user_id"].(float64)
+    if !ok {
+        return nil, 0, fmt.Errorf("malformed %s token", purpose)
+    }
+    return claims, int(userID), nil
+}
 
-    if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-        return claims, nil
+// GenerateEmailVerificationToken signs a link token binding userID to the
+// address being verified, so changing the email invalidates older links.
+func GenerateEmailVerificationToken(userID int, email string) (string, error) {
+    return signPurposeToken(purposeEmailVerification, jwt.MapClaims{
+        "user_id": userID,
+        "email":   email,
+    }, EmailVerificationTTL)
+}
+
+// VerifyEmailVerificationToken checks a token from GenerateEmailVerificationToken
+// and returns the user and email it was issued for.
+func VerifyEmailVerificationToken(tokenString string) (int, string, error) {
+    claims, userID, err := verifyPurposeToken(tokenString, purposeEmailVerification)
+    if err != nil {
+        return 0, "", err
+    }
+    email, _ := claims["email"].(string)
+    if email == "" {
+        return 0, "", errors.New("malformed email verification token")
     }
+    return userID, email, nil
+}
+
+// GenerateTwoFactorChallenge signs the token returned by the password step
+// of a login for an account with two-factor authentication.
+func GenerateTwoFactorChallenge(userID int) (string, error) {
+    return signPurposeToken(purposeTwoFactorChallenge, jwt.MapClaims{
+        "user_id": userID,
+    }, TwoFactorChallengeTTL)
+}
 
-    return nil, errors.New("invalid token")
+// VerifyTwoFactorChallenge returns the user a challenge was issued for.
+func VerifyTwoFactorChallenge(tokenString string) (int, error) {
+    _, userID, err := verifyPurposeToken(tokenString, purposeTwoFactorChallenge)
+    return userID, err
 }
 
-func GenerateToken(userID int, username string, role string) (string, error) {
+// GenerateToken signs an access token. mfa records that the session was
+// established with a second factor.
+func GenerateToken(userID int, username string, role string, mfa bool) (string, error) {
+    jti, err := randomToken(16)
+    if err != nil {
+        return "", err
+    }
+
+    now := time.Now()
     claims := jwt.MapClaims{
         "user_id":  userID,
         "username": username,
         "role":     role,
-        "exp":      time.Now().Add(24 * time.Hour).Unix(),
+        "jti":      jti,
+        "iat":      now.Unix(),
+        "exp":      now.Add(AccessTokenTTL).Unix(),
+    }
+    if mfa {
+        claims["mfa"] = true
+    }
+
+    return Tokens().Sign(claims)
+}
+
+// GenerateRefreshToken returns an opaque refresh token for the client and
+// the hash under which it is stored. The plain token is never persisted.
+func GenerateRefreshToken() (token string, hash string, err error) {
+    return GenerateOpaqueToken()
+}
+
+// GenerateOpaqueToken returns a random 256-bit token and its HashToken hash,
+// for secrets such as password reset links that are stored only hashed.
+func GenerateOpaqueToken() (token string, hash string, err error) {
+    token, err = randomToken(32)
+    if err != nil {
+        return "", "", err
     }
+    return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of an opaque token. Opaque tokens carry
+// 256 bits of entropy, so a fast unsalted hash is sufficient.
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(jwtKey)
+func randomToken(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LegacyKeyID identifies the JWT_SECRET key. Tokens issued before key IDs
+// were introduced carry no "kid" header and are checked against it.
+const LegacyKeyID = "default"
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   interface{} // nil for verify-only keys
+	verify interface{}
+}
+
+// TokenService signs and verifies JWTs with a set of keys addressed by kid.
+// Exactly one key is active for signing; every loaded key is accepted for
+// verification, which is what makes rotation possible without downtime:
+//
+//  1. add the new key on every instance (it is now trusted),
+//  2. point JWT_ACTIVE_KID at it (new tokens use it),
+//  3. remove the old key once its last tokens have expired.
+type TokenService struct {
+	mu        sync.RWMutex
+	keys      map[string]*signingKey
+	activeKID string
+}
+
+func NewTokenService() *TokenService {
+	return &TokenService{keys: map[string]*signingKey{}}
+}
+
+// AddHMACKey registers an HS256 shared secret.
+func (s *TokenService) AddHMACKey(kid string, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("key %q: empty secret", kid)
+	}
+	s.put(&signingKey{kid: kid, method: jwt.SigningMethodHS256, sign: secret, verify: secret})
+	return nil
+}
+
+// AddPEMKey registers an RSA (RS256) or Ed25519 (EdDSA) key. Private keys
+// can sign and verify; public keys only verify.
+func (s *TokenService) AddPEMKey(kid string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("key %q: no PEM block found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return fmt.Errorf("key %q: unsupported PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("key %q: %w", kid, err)
+	}
+
+	k := &signingKey{kid: kid}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.sign, k.verify = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.verify = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.method, k.sign, k.verify = jwt.SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.method, k.verify = jwt.SigningMethodEdDSA, key
+	default:
+		return fmt.Errorf("key %q: unsupported key type %T", kid, parsed)
+	}
+	s.put(k)
+	return nil
+}
+
+func (s *TokenService) put(k *signingKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.kid] = k
+}
+
+// SetActive selects the key used to sign new tokens.
+func (s *TokenService) SetActive(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[kid]
+	if !ok {
+		return fmt.Errorf("active key %q is not loaded", kid)
+	}
+	if k.sign == nil {
+		return fmt.Errorf("active key %q is a public key and cannot sign", kid)
+	}
+	s.activeKID = kid
+	return nil
+}
+
+// ActiveKeyID returns the kid new tokens are signed with.
+func (s *TokenService) ActiveKeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeKID
+}
+
+// Sign signs the claims with the active key and sets the "kid" header.
+func (s *TokenService) Sign(claims jwt.MapClaims) (string, error) {
+	s.mu.RLock()
+	k, ok := s.keys[s.activeKID]
+	s.mu.RUnlock()
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	return token.SignedString(k.sign)
+}
+
+// Verify checks the signature against the key named by the token's kid and
+// returns its claims. The algorithm must match the key, so a token cannot
+// choose how it is verified.
+func (s *TokenService) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = LegacyKeyID
+		}
+
+		s.mu.RLock()
+		k, ok := s.keys[kid]
+		s.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return k.verify, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. Shared HMAC secrets
+// are never published.
+func (s *TokenService) JWKS() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := []map[string]string{}
+	for _, kid := range kids {
+		k := s.keys[kid]
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": kid,
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// TokenConfig selects the keys of the token service:
+//
+//	Secret     HS256 secret registered as kid "default" (JWT_SECRET)
+//	KeysDir    directory of keys; the file name without extension is the
+//	           kid. *.pem holds an RSA or Ed25519 key, *.key an HS256 secret
+//	           (JWT_KEYS_DIR)
+//	ActiveKID  kid used for signing, "default" if empty (JWT_ACTIVE_KID)
+//
+// Without Secret no "default" key exists, so tokens without a kid header
+// are rejected.
+type TokenConfig struct {
+	Secret    string
+	KeysDir   string
+	ActiveKID string
+}
+
+// Validate reports settings LoadTokenService would reject without reading
+// any key.
+func (c TokenConfig) Validate() error {
+	if c.Secret == "" && c.KeysDir == "" {
+		return errors.New("no JWT signing key configured; set JWT_SECRET or JWT_KEYS_DIR")
+	}
+	if c.KeysDir != "" {
+		info, err := os.Stat(c.KeysDir)
+		if err != nil {
+			return fmt.Errorf("JWT_KEYS_DIR: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("JWT_KEYS_DIR %q is not a directory", c.KeysDir)
+		}
+	}
+	if c.Secret == "" && c.ActiveKID == "" {
+		return errors.New("JWT_ACTIVE_KID must be set when JWT_SECRET is not")
+	}
+	return nil
+}
+
+// LoadTokenService builds the TokenService c describes.
+func LoadTokenService(c TokenConfig) (*TokenService, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	s := NewTokenService()
+
+	if c.Secret != "" {
+		if err := s.AddHMACKey(LegacyKeyID, []byte(c.Secret)); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir := c.KeysDir; dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT_KEYS_DIR: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			ext := filepath.Ext(entry.Name())
+			kid := strings.TrimSuffix(entry.Name(), ext)
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			switch ext {
+			case ".pem":
+				err = s.AddPEMKey(kid, data)
+			case ".key":
+				err = s.AddHMACKey(kid, []byte(strings.TrimSpace(string(data))))
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Loaded JWT key %q", kid)
+		}
+	}
+
+	if len(s.keys) == 0 {
+		return nil, errors.New("no JWT signing key configured; set JWT_SECRET or JWT_KEYS_DIR")
+	}
+
+	active := c.ActiveKID
+	if active == "" {
+		active = LegacyKeyID
+	}
+	if err := s.SetActive(active); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var (
+	tokenService     *TokenService
+	tokenServiceErr  error
+	tokenServiceOnce sync.Once
+)
+
+// InitTokenService loads the process-wide token service from c. Only the
+// first call has an effect; main makes it with the loaded configuration.
+func InitTokenService(c TokenConfig) error {
+	tokenServiceOnce.Do(func() {
+		tokenService, tokenServiceErr = LoadTokenService(c)
+	})
+	return tokenServiceErr
+}
+
+// Tokens returns the process-wide token service.
+func Tokens() *TokenService {
+	if tokenServiceErr != nil {
+		log.Fatalf("Failed to load JWT keys: %v", tokenServiceErr)
+	}
+	if tokenService == nil {
+		log.Fatal("Token service used before InitTokenService")
+	}
+	return tokenService
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 4226 and RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 4226 appendix D.
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B (SHA-1), truncated to six digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfcSecret, tt.code, at)
+		if !ok {
+			t.Errorf("ValidateTOTP(%s) at %d rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / 30; step != want {
+			t.Errorf("ValidateTOTP(%s) at %d step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkewAndInput(t *testing.T) {
+	// "050471" is the code of step 37037037.
+	at := time.Unix(1111111111, 0)
+	period := TOTPPeriod
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		ok     bool
+	}{
+		{"one period late", rfcSecret, "050471", at.Add(period), true},
+		{"one period early", rfcSecret, "050471", at.Add(-period), true},
+		{"two periods late", rfcSecret, "050471", at.Add(2 * period), false},
+		{"spaces in code", rfcSecret, " 050 471 ", at, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", at, true},
+		{"wrong code", rfcSecret, "050472", at, false},
+		{"too short", rfcSecret, "05047", at, false},
+		{"too long", rfcSecret, "0504710", at, false},
+		{"invalid secret", "not base32!", "050471", at, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, tt.at); ok != tt.ok {
+				t.Errorf("ValidateTOTP = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q does not decode to 20 bytes: %v", secret, err)
+	}
+
+	now := time.Now()
+	code := hotp(key, uint64(TOTPStep(now)))
+	if step, ok := ValidateTOTP(secret, code, now); !ok || step != TOTPStep(now) {
+		t.Errorf("fresh code rejected: step %d, ok %v", step, ok)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !format.MatchString(c) {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+
+	if HashRecoveryCode("ABCDE-FGHIJ") != HashRecoveryCode("abcde fghij") {
+		t.Error("HashRecoveryCode does not normalise case and separators")
+	}
+}